@@ -4,6 +4,7 @@ go 1.23.0
 
 require (
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/sync v0.11.0
 	golang.org/x/time v0.11.0
 )
 
@@ -1,53 +1,166 @@
 package rr
 
-import "slices"
+import (
+	"slices"
+	"sync"
+)
 
+// WeightedRoundRobin is an interleaved weighted round robin: in round r every
+// index with weight at least r is selected once, in index order. The order is
+// fully deterministic and carries over weight updates.
+//
+// It is safe for concurrent use. Note that a Peek followed by a Skip or
+// Dispatch is not atomic, callers that need that must hold their own lock
+// around the pair.
 type WeightedRoundRobin struct {
-	weights   []int // cap of each node divided by total cap, rounded
-	rounds    int   // number of rounds of weighted round robin, equal to max weight
-	currIndex int   // current index we are at for interleaved round robin
-	currRound int   // the current round we are in for interleaved round robin
+	mut       sync.Mutex
+	s         *schedule // current schedule, replaced and never modified
+	maxRounds int       // upper bound on rounds, 0 means unbounded
+	currIndex int       // current index we are at for interleaved round robin
+	currRound int       // the current round we are in for interleaved round robin
+}
+
+// An immutable schedule. Updates build a new one and swap it in, so a
+// selection never sees a half updated schedule.
+type schedule struct {
+	weights []int // cap of each node divided by total cap, rounded
+	sched   []int // weights scaled down so that the max is at most maxRounds
+	rounds  int   // number of rounds of weighted round robin, equal to max weight
 }
 
 func NewWeightedRoundRobin(weights []int) *WeightedRoundRobin {
-	return &WeightedRoundRobin{
-		weights:   weights,
-		rounds:    0,
+	r := &WeightedRoundRobin{
+		maxRounds: 0,
 		currIndex: 0,
-		currRound: 0,
+		currRound: 1,
 	}
+	r.updateWeights(weights)
+	return r
 }
 
-func (r *WeightedRoundRobin) advanceIndex() {
-	r.currIndex++
-	if r.currIndex >= len(r.weights) {
-		r.currIndex = 0
-		r.currRound++
-		if r.currRound > r.rounds {
-			r.currRound = 1
+// Returns the position right after the given one.
+func (s *schedule) advance(index int, round int) (int, int) {
+	index++
+	if index >= len(s.sched) {
+		index = 0
+		round++
+		if round > s.rounds {
+			round = 1
 		}
 	}
+	return index, round
 }
 
-func (r *WeightedRoundRobin) Dispatch() int {
-	for {
-		if r.weights[r.currIndex] >= r.currRound {
-			break
-		} else {
-			r.advanceIndex()
+// Returns the next index to be selected starting from the given position, and
+// the position right after it.
+func (s *schedule) find(index int, round int) (int, int, int) {
+	for s.sched[index] < round {
+		index, round = s.advance(index, round)
+	}
+	nextIndex, nextRound := s.advance(index, round)
+	return index, nextIndex, nextRound
+}
+
+// Builds the schedule for the given weights. The weights are copied so the
+// caller is free to reuse the slice.
+func newSchedule(weights []int, maxRounds int) *schedule {
+	s := &schedule{weights: slices.Clone(weights)}
+	s.sched = s.weights
+	if len(weights) == 0 {
+		return s
+	}
+	s.rounds = slices.Max(weights)
+
+	if s.rounds <= 0 {
+		// Nothing has any weight, fall back to a plain round robin instead
+		// of looping forever looking for an eligible index.
+		s.sched = make([]int, len(weights))
+		for i := range s.sched {
+			s.sched[i] = 1
+		}
+		s.rounds = 1
+	} else if maxRounds > 0 && s.rounds > maxRounds {
+		s.sched = make([]int, len(weights))
+		for i, w := range weights {
+			if w <= 0 {
+				continue
+			}
+			s.sched[i] = max(w*maxRounds/s.rounds, 1)
 		}
+		s.rounds = maxRounds
 	}
-	index := r.currIndex
-	r.advanceIndex()
+	return s
+}
+
+func (r *WeightedRoundRobin) Dispatch() int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	var index int
+	index, r.currIndex, r.currRound = r.s.find(r.currIndex, r.currRound)
+	return index
+}
 
+// Returns the index the next call to Dispatch will return, without selecting
+// it.
+func (r *WeightedRoundRobin) Peek() int {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	index, _, _ := r.s.find(r.currIndex, r.currRound)
 	return index
 }
 
+// Moves past index if it is the next to be selected, e.g. after finding out
+// from Peek that it can't be used right now. It loses its turn for this round,
+// the rest of the schedule is unaffected. Returns whether it was skipped.
+func (r *WeightedRoundRobin) Skip(index int) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	next, nextIndex, nextRound := r.s.find(r.currIndex, r.currRound)
+	if next != index {
+		return false
+	}
+	r.currIndex, r.currRound = nextIndex, nextRound
+	return true
+}
+
+// Returns the current weights. The slice must not be modified.
 func (r *WeightedRoundRobin) GetWeights() []int {
-	return r.weights
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.s.weights
+}
+
+// Sets the maximum number of rounds (i.e. the maximum scheduled weight). If
+// the weights exceed this they are scaled down proportionally before being
+// scheduled, with every non zero weight kept at least 1. This bounds how long a
+// single dominant weight can monopolize the schedule. 0 means unbounded. The
+// schedule is only rebuilt if the maximum changes.
+func (r *WeightedRoundRobin) SetMaxRounds(maxRounds int) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	if maxRounds == r.maxRounds {
+		return
+	}
+	r.maxRounds = maxRounds
+	r.updateWeights(r.s.weights)
 }
 
 func (r *WeightedRoundRobin) UpdateWeights(weights []int) {
-	r.weights = weights
-	r.rounds = slices.Max(r.weights)
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	r.updateWeights(weights)
+}
+
+// Installs a new schedule. The cursor carries over if it still fits, so that a
+// weight change does not restart the round. If the number of weights changed
+// the old position means nothing and the cursor restarts from the beginning.
+func (r *WeightedRoundRobin) updateWeights(weights []int) {
+	s := newSchedule(weights, r.maxRounds)
+	if r.s == nil || len(r.s.sched) != len(s.sched) {
+		r.currIndex, r.currRound = 0, 1
+	}
+	if r.currRound > s.rounds {
+		r.currRound = 1
+	}
+	r.s = s
 }
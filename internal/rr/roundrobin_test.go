@@ -55,3 +55,179 @@ L:
 		assert.InDelta(t, rates[i], actualRate, 1, "hander %d")
 	}
 }
+
+// Counts how many times each index is picked over the given number of
+// dispatches.
+func countDispatches(r *rr.WeightedRoundRobin, n int, dispatches int) []int {
+	counts := make([]int, n)
+	for range dispatches {
+		counts[r.Dispatch()]++
+	}
+	return counts
+}
+
+func TestMaxRoundsCapsDominantWeight(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{10000, 1, 1})
+	roundRobin.SetMaxRounds(100)
+
+	// the returned weights are untouched, only the schedule is capped
+	assert.Equal(t, []int{10000, 1, 1}, roundRobin.GetWeights())
+
+	// a full schedule is 100 + 1 + 1 dispatches
+	counts := countDispatches(roundRobin, 3, 102)
+	assert.Equal(t, []int{100, 1, 1}, counts)
+}
+
+func TestMaxRoundsKeepsProportions(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{600, 300, 100})
+	roundRobin.SetMaxRounds(6)
+
+	counts := countDispatches(roundRobin, 3, 100)
+	assert.Equal(t, []int{60, 30, 10}, counts)
+}
+
+// Tests that setting the same maximum again doesn't rebuild the schedule, as
+// the load balancer does before every weight update.
+func TestMaxRoundsUnchanged(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{600, 300, 100})
+	roundRobin.SetMaxRounds(6)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		roundRobin.SetMaxRounds(6)
+	})
+	assert.Zero(t, allocs)
+	counts := countDispatches(roundRobin, 3, 100)
+	assert.Equal(t, []int{60, 30, 10}, counts)
+}
+
+func TestAllZeroWeights(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{0, 0, 0})
+
+	// should not spin forever, falls back to plain round robin
+	counts := countDispatches(roundRobin, 3, 30)
+	assert.Equal(t, []int{10, 10, 10}, counts)
+}
+
+func TestSomeZeroWeights(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{0, 5, 0})
+
+	counts := countDispatches(roundRobin, 3, 50)
+	assert.Equal(t, []int{0, 50, 0}, counts)
+}
+
+func TestPeekAndSkip(t *testing.T) {
+	roundRobin := rr.NewWeightedRoundRobin([]int{2, 1, 1})
+
+	// full schedule is 0 1 2 0
+	assert.Equal(t, 0, roundRobin.Peek())
+	assert.Equal(t, 0, roundRobin.Peek())
+	assert.Equal(t, 0, roundRobin.Dispatch())
+
+	assert.Equal(t, 1, roundRobin.Peek())
+	assert.False(t, roundRobin.Skip(2))
+	assert.True(t, roundRobin.Skip(1))
+
+	assert.Equal(t, 2, roundRobin.Peek())
+	assert.Equal(t, 2, roundRobin.Dispatch())
+	assert.Equal(t, 0, roundRobin.Dispatch())
+
+	// and around again
+	assert.Equal(t, []int{4, 2, 2}, countDispatches(roundRobin, 3, 8))
+}
+
+func TestConcurrentDispatchAndUpdate(t *testing.T) {
+	r := rr.NewWeightedRoundRobin([]int{1, 2, 3})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				index := r.Dispatch()
+				assert.GreaterOrEqual(t, index, 0)
+				assert.Less(t, index, 3)
+				r.Peek()
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			r.UpdateWeights([]int{i % 5, 1, 3})
+			r.SetMaxRounds(i % 3)
+			assert.Len(t, r.GetWeights(), 3)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestResizeResetsCursor(t *testing.T) {
+	r := rr.NewWeightedRoundRobin([]int{1, 1, 1, 1})
+	r.Dispatch()
+	r.Dispatch()
+	r.Dispatch()
+
+	r.UpdateWeights([]int{1, 1})
+	assert.Equal(t, 0, r.Dispatch())
+	assert.Equal(t, 1, r.Dispatch())
+}
+
+func TestUpdateWeightsCopies(t *testing.T) {
+	weights := []int{1, 0}
+	r := rr.NewWeightedRoundRobin(weights)
+	weights[1] = 5
+	assert.Equal(t, []int{1, 0}, r.GetWeights())
+	assert.Equal(t, []int{10, 0}, countDispatches(r, 2, 10))
+}
+
+func TestResizeDuringDispatch(t *testing.T) {
+	r := rr.NewWeightedRoundRobin([]int{1, 2, 3, 4, 5})
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				index := r.Dispatch()
+				assert.GreaterOrEqual(t, index, 0)
+				assert.Less(t, index, 5)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			r.UpdateWeights(make([]int, 1+i%5))
+		}
+	}()
+	wg.Wait()
+
+	// After shrinking, every index handed out fits the final schedule.
+	r.UpdateWeights([]int{3, 1})
+	for range 100 {
+		assert.Less(t, r.Dispatch(), 2)
+	}
+}
+
+func TestStableOrder(t *testing.T) {
+	r := rr.NewWeightedRoundRobin([]int{2, 2, 1})
+	// Index order within each round
+	assert.Equal(t, []int{0, 1, 2, 0, 1}, dispatchOrder(r, 5))
+
+	// A weight update keeps the position in the round
+	r.Dispatch()
+	r.UpdateWeights([]int{2, 2, 2})
+	assert.Equal(t, []int{1, 2, 0, 1, 2}, dispatchOrder(r, 5))
+}
+
+func dispatchOrder(r *rr.WeightedRoundRobin, dispatches int) []int {
+	order := make([]int, dispatches)
+	for i := range order {
+		order[i] = r.Dispatch()
+	}
+	return order
+}
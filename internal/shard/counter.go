@@ -0,0 +1,45 @@
+package shard
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+const numShards = 8
+
+// Keeps each shard on its own cache line so they don't contend.
+type paddedInt64 struct {
+	atomic.Int64
+	_ [56]byte
+}
+
+// A counter split over several shards so that many goroutines can add to it at
+// once without all hitting the same cache line. Reading it is more expensive,
+// so it suits counters that are written often and read rarely. The zero value
+// is ready to use.
+type Counter struct {
+	shards [numShards]paddedInt64
+}
+
+func (c *Counter) Add(delta int64) {
+	c.shards[rand.Uint32()%numShards].Add(delta)
+}
+
+func (c *Counter) Load() int64 {
+	total := int64(0)
+	for i := range c.shards {
+		total += c.shards[i].Load()
+	}
+	return total
+}
+
+// Resets the counter to zero, returning what it was. Adds that happen
+// concurrently are either included in the result or kept for the next reset,
+// never lost.
+func (c *Counter) Reset() int64 {
+	total := int64(0)
+	for i := range c.shards {
+		total += c.shards[i].Swap(0)
+	}
+	return total
+}
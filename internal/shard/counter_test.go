@@ -0,0 +1,32 @@
+package shard_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/internal/shard"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCounterConcurrentAdds(t *testing.T) {
+	var c shard.Counter
+	var wg sync.WaitGroup
+	resets := int64(0)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				c.Add(1)
+			}
+		}()
+	}
+	for range 10 {
+		resets += c.Reset()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10000), resets+c.Load())
+	assert.Equal(t, int64(10000), resets+c.Reset())
+	assert.Equal(t, int64(0), c.Load())
+}
@@ -0,0 +1,64 @@
+package lb
+
+import "context"
+
+// Wraps a function that doesn't take a context into a [HandlerFunc]. Since the
+// function can't be interrupted, the context is only checked before calling it.
+func Adapt[T any, U any](f func(T) (U, error)) HandlerFunc[T, U] {
+	return func(ctx context.Context, param T) (U, error) {
+		if err := ctx.Err(); err != nil {
+			var res U
+			return res, err
+		}
+		return f(param)
+	}
+}
+
+// Wraps a plain function that neither takes a context nor fails into a
+// [HandlerFunc]. The context is only checked before calling it.
+func AdaptNoCtx[T any, U any](f func(T) U) HandlerFunc[T, U] {
+	return Adapt(func(param T) (U, error) {
+		return f(param), nil
+	})
+}
+
+// Binds a method expression to a receiver to get a [HandlerFunc], e.g.
+//
+//	lb.AdaptMethod(client, (*Client).Fetch)
+func AdaptMethod[R any, T any, U any](recv R, method func(R, context.Context, T) (U, error)) HandlerFunc[T, U] {
+	return func(ctx context.Context, param T) (U, error) {
+		return method(recv, ctx, param)
+	}
+}
+
+// Converts the results of a [HandlerFunc], e.g. to put handlers returning
+// different concrete types behind a shared interface without erasing them to
+// any. The conversion is checked at compile time:
+//
+//	lb.Map(fetchUser, func(u *User) Entity { return u })
+//
+// conv is only called on results returned without an error.
+func Map[T any, U1 any, U2 any](f HandlerFunc[T, U1], conv func(U1) U2) HandlerFunc[T, U2] {
+	return func(ctx context.Context, param T) (U2, error) {
+		res, err := f(ctx, param)
+		if err != nil {
+			var zero U2
+			return zero, err
+		}
+		return conv(res), nil
+	}
+}
+
+// Like [Map], but converts a whole [Handler], keeping everything else about it.
+func MapHandler[T any, U1 any, U2 any](h Handler[T, U1], conv func(U1) U2) Handler[T, U2] {
+	return Handler[T, U2]{
+		Name:             h.Name,
+		EstCap:           h.EstCap,
+		Dispatch:         Map(h.Dispatch, conv),
+		Data:             h.Data,
+		MaxRate:          h.MaxRate,
+		WeightHint:       h.WeightHint,
+		CapacitySchedule: h.CapacitySchedule,
+		Overrides:        h.Overrides,
+	}
+}
@@ -0,0 +1,104 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+type multiplier struct {
+	factor int
+}
+
+func (m *multiplier) Mul(ctx context.Context, param int) (int, error) {
+	return param * m.factor, nil
+}
+
+func TestAdapt(t *testing.T) {
+	f := lb.Adapt(strconv.Atoi)
+
+	res, err := f(context.Background(), "12")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, res)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = f(ctx, "12")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = f(context.Background(), "twelve")
+	assert.Error(t, err)
+}
+
+func TestAdaptNoCtx(t *testing.T) {
+	f := lb.AdaptNoCtx(strconv.Itoa)
+
+	res, err := f(context.Background(), 12)
+	assert.NoError(t, err)
+	assert.Equal(t, "12", res)
+}
+
+func TestAdaptMethod(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap:   1,
+		Dispatch: lb.AdaptMethod(&multiplier{factor: 3}, (*multiplier).Mul),
+	})
+
+	res, err := balancer.Dispatch(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, res)
+}
+
+type shape interface {
+	Area() float64
+}
+
+type square struct{ side float64 }
+
+func (s square) Area() float64 { return s.side * s.side }
+
+type circle struct{ radius float64 }
+
+func (c *circle) Area() float64 { return 3 * c.radius * c.radius }
+
+func TestMap(t *testing.T) {
+	squares := lb.Handler[float64, square]{
+		Name:   "squares",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, size float64) (square, error) {
+			return square{size}, nil
+		},
+	}
+	circles := lb.Handler[float64, *circle]{
+		Name:   "circles",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, size float64) (*circle, error) {
+			if size < 0 {
+				return nil, errors.New("negative size")
+			}
+			return &circle{size}, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.MapHandler(squares, func(s square) shape { return s }),
+		lb.MapHandler(circles, func(c *circle) shape { return c }),
+	)
+	balancer.ExplorationRate = 0
+
+	areas := map[float64]int{}
+	for range 4 {
+		res, err := balancer.Dispatch(context.Background(), 2)
+		assert.NoError(t, err)
+		areas[res.Area()]++
+	}
+	assert.Equal(t, map[float64]int{4: 2, 12: 2}, areas)
+
+	f := lb.Map(circles.Dispatch, func(c *circle) shape { return c })
+	res, err := f(context.Background(), -1)
+	assert.Error(t, err)
+	assert.Nil(t, res)
+}
@@ -0,0 +1,257 @@
+package lb
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Returned by [LoadBalancer.Dispatch] when the call is turned away because too
+// many calls are running, see [Config.MaxInFlight].
+var ErrShed = errors.New("lb shed")
+
+// Counts the dispatches running, and under [Config.MaxInFlight] queues those
+// waiting for one to finish.
+type admission struct {
+	mut      sync.Mutex
+	inFlight int
+	used     int           // slots taken by the dispatches running, see WithCost
+	waiters  list.List     // of *waiter, oldest first
+	draining bool          // whether Shutdown was called
+	idle     chan struct{} // closed once draining and nothing is left, nil otherwise
+
+	enqueued    int64         // total dispatches that had to wait
+	dropped     int64         // total dispatches shed or that gave up waiting
+	cancelled   int64         // total dispatches that gave up waiting, included in dropped
+	refused     int64         // total dispatches turned away with ErrShuttingDown
+	finished    int64         // total dispatches that ran and gave back their slot
+	wait        time.Duration // moving average of the time waited for a slot
+	lastTick    time.Time     // when the rates were last updated
+	lastEnqueue int64         // enqueued as of lastTick
+	lastDrop    int64         // dropped as of lastTick
+	enqueueRate float64
+	dropRate    float64
+
+	codel codel
+}
+
+// The state of the queue of dispatches waiting under [Config.MaxInFlight].
+// Unlike the handler stats this includes demand that was never served.
+type QueueStats struct {
+	// Dispatches waiting for a slot right now
+	Depth int `json:"depth"`
+	// Dispatches running right now
+	InFlight int `json:"in_flight"`
+	// Total dispatches that had to wait for a slot
+	Enqueued int64 `json:"enqueued"`
+	// Total dispatches turned away with [ErrShed] or that gave up waiting
+	Dropped int64 `json:"dropped"`
+	// Dispatches per second that had to wait, over the last tick
+	EnqueueRate float64 `json:"enqueue_rate"`
+	// Dispatches per second dropped, over the last tick
+	DropRate float64 `json:"drop_rate"`
+	// Moving average of the time dispatches waited for a slot, see
+	// [Config.LatencySmoothingFactor]
+	Wait time.Duration `json:"wait"`
+}
+
+// A dispatch waiting for a slot.
+type waiter struct {
+	ready    chan struct{} // closed when handed a slot or failed
+	err      error         // why it was failed rather than handed a slot
+	elem     *list.Element
+	priority int
+	cost     int       // slots it takes, see WithCost
+	deadline time.Time // zero if none
+	since    time.Time // when it started waiting
+}
+
+type costKey struct{}
+
+// Returns a context that makes any dispatch made with it take n slots of
+// [Config.MaxInFlight] instead of one, so an expensive request holds back as
+// many others as it is worth. Costs above MaxInFlight take all of its slots.
+// Also used by [WrapWithWeightedSemaphore].
+func WithCost(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, costKey{}, n)
+}
+
+// Returns the cost given to ctx with [WithCost], at least 1.
+func cost(ctx context.Context) int {
+	n, _ := ctx.Value(costKey{}).(int)
+	return max(n, 1)
+}
+
+// Takes slots for a dispatch, waiting for them if needed. Returns the number
+// of slots taken, to give back to release.
+func (l *LoadBalancer[T, U]) admit(ctx context.Context) (int, error) {
+	n := cost(ctx)
+	if l.MaxInFlight > 0 {
+		n = min(n, l.MaxInFlight)
+	}
+
+	a := &l.admission
+	a.mut.Lock()
+	if a.draining {
+		a.refused++
+		a.mut.Unlock()
+		return 0, ErrShuttingDown
+	}
+	if l.MaxInFlight <= 0 || (a.used+n <= l.MaxInFlight && a.waiters.Len() == 0) {
+		a.take(n)
+		a.mut.Unlock()
+		return n, nil
+	}
+	if l.ShedWhenFull {
+		a.dropped++
+		a.mut.Unlock()
+		return 0, ErrShed
+	}
+
+	w := &waiter{ready: make(chan struct{}), priority: priority(ctx), cost: n, since: time.Now()}
+	w.deadline, _ = ctx.Deadline()
+	if l.MaxQueue > 0 && a.waiters.Len() >= l.MaxQueue {
+		victim := a.victim(l.ShedStrategy, w)
+		if victim == w {
+			a.dropped++
+			a.mut.Unlock()
+			return 0, ErrShed
+		}
+		a.fail(victim, ErrShed)
+	}
+	w.elem = a.waiters.PushBack(w)
+	a.enqueued++
+	a.mut.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return 0, w.err
+		}
+		a.mut.Lock()
+		a.observeWait(l.LatencySmoothingFactor, time.Since(start))
+		a.mut.Unlock()
+		return n, nil
+	case <-ctx.Done():
+		a.mut.Lock()
+		select {
+		case <-w.ready:
+			a.mut.Unlock()
+			if w.err == nil {
+				// Got handed the slots just now, pass them on
+				l.release(n)
+			}
+		default:
+			a.dropped++
+			a.cancelled++
+			a.waiters.Remove(w.elem)
+			// Those behind may fit where it didn't
+			l.grant()
+			a.checkIdle()
+			a.mut.Unlock()
+		}
+		return 0, ctx.Err()
+	}
+}
+
+// Counts a dispatch taking n slots as running. Needs the lock.
+func (a *admission) take(n int) {
+	a.inFlight++
+	a.used += n
+}
+
+// Takes a waiting dispatch out of the queue and fails it with err. Needs the
+// lock.
+func (a *admission) fail(w *waiter, err error) {
+	a.waiters.Remove(w.elem)
+	w.err = err
+	close(w.ready)
+	a.dropped++
+}
+
+// Folds the time a dispatch waited into the moving average. Needs the lock.
+func (a *admission) observeWait(alpha float64, wait time.Duration) {
+	if a.wait == 0 {
+		a.wait = wait
+		return
+	}
+	a.wait = time.Duration(alpha*float64(wait) + (1-alpha)*float64(a.wait))
+}
+
+// Updates the rates from the counts since the last tick.
+func (a *admission) tick(t time.Time) {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	if !a.lastTick.IsZero() {
+		if elapsed := t.Sub(a.lastTick).Seconds(); elapsed > 0 {
+			a.enqueueRate = float64(a.enqueued-a.lastEnqueue) / elapsed
+			a.dropRate = float64(a.dropped-a.lastDrop) / elapsed
+		}
+	}
+	a.lastTick = t
+	a.lastEnqueue = a.enqueued
+	a.lastDrop = a.dropped
+}
+
+func (a *admission) stats() QueueStats {
+	a.mut.Lock()
+	defer a.mut.Unlock()
+
+	return QueueStats{
+		Depth:       a.waiters.Len(),
+		InFlight:    a.inFlight,
+		Enqueued:    a.enqueued,
+		Dropped:     a.dropped,
+		EnqueueRate: a.enqueueRate,
+		DropRate:    a.dropRate,
+		Wait:        a.wait,
+	}
+}
+
+// Returns the state of the queue of dispatches waiting under
+// [Config.MaxInFlight].
+func (l *LoadBalancer[T, U]) GetQueueStats() QueueStats {
+	return l.admission.stats()
+}
+
+// Gives back the n slots of a finished dispatch, see [LoadBalancer.grant].
+func (l *LoadBalancer[T, U]) release(n int) {
+	a := &l.admission
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	a.finished++
+	a.inFlight--
+	a.used -= n
+	l.grant()
+	a.checkIdle()
+}
+
+// Hands free slots straight to the longest waiting dispatches, for as long as
+// the next one fits. While shutting down they go to the waiting dispatches
+// with the highest priority instead. Needs the lock.
+func (l *LoadBalancer[T, U]) grant() {
+	a := &l.admission
+	now := time.Now()
+	for {
+		var w *waiter
+		if a.draining {
+			w = a.highestPriority()
+		} else if front := a.waiters.Front(); front != nil {
+			w = front.Value.(*waiter)
+		}
+		if w == nil || (l.MaxInFlight > 0 && a.used+w.cost > l.MaxInFlight) {
+			return
+		}
+		if !a.draining && a.codel.drop(l.CoDelTarget, l.CoDelInterval, now, now.Sub(w.since)) {
+			a.fail(w, ErrShed)
+			continue
+		}
+		a.waiters.Remove(w.elem)
+		a.take(w.cost)
+		close(w.ready)
+	}
+}
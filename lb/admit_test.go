@@ -0,0 +1,156 @@
+package lb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a load balancer whose handler blocks until unblock is closed, and
+// starts n dispatches that block in it.
+func newBlockedBalancer(t *testing.T, n int) (*lb.LoadBalancer[int, int], chan struct{}, *sync.WaitGroup) {
+	unblock := make(chan struct{})
+	started := make(chan struct{}, n)
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			started <- struct{}{}
+			<-unblock
+			return param, nil
+		},
+	})
+	balancer.MaxInFlight = n
+
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := balancer.Dispatch(context.Background(), i)
+			assert.NoError(t, err)
+		}()
+	}
+	for range n {
+		<-started
+	}
+	return balancer, unblock, &wg
+}
+
+func TestMaxInFlightShed(t *testing.T) {
+	balancer, unblock, wg := newBlockedBalancer(t, 2)
+	balancer.ShedWhenFull = true
+
+	_, err := balancer.Dispatch(context.Background(), 0)
+	assert.ErrorIs(t, err, lb.ErrShed)
+	stats := balancer.GetQueueStats()
+	assert.Equal(t, 2, stats.InFlight)
+	assert.Equal(t, 0, stats.Depth)
+	assert.Equal(t, int64(1), stats.Dropped)
+
+	close(unblock)
+	wg.Wait()
+	_, err = balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+}
+
+func TestMaxInFlightWait(t *testing.T) {
+	balancer, unblock, wg := newBlockedBalancer(t, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := balancer.Dispatch(ctx, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() {
+		_, err := balancer.Dispatch(context.Background(), 0)
+		done <- err
+	}()
+	select {
+	case <-done:
+		t.Fatal("dispatch should wait for a slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	assert.Equal(t, 1, balancer.GetQueueStats().Depth)
+
+	close(unblock)
+	assert.NoError(t, <-done)
+	wg.Wait()
+
+	stats := balancer.GetQueueStats()
+	assert.Equal(t, 0, stats.Depth)
+	assert.Equal(t, 0, stats.InFlight)
+	assert.Equal(t, int64(2), stats.Enqueued)
+	assert.Equal(t, int64(1), stats.Dropped)
+	assert.GreaterOrEqual(t, stats.Wait, 20*time.Millisecond)
+}
+
+func TestQueueRates(t *testing.T) {
+	balancer, unblock, wg := newBlockedBalancer(t, 1)
+	balancer.ShedWhenFull = true
+	balancer.TickOnce()
+
+	for range 10 {
+		balancer.Dispatch(context.Background(), 0)
+	}
+	time.Sleep(10 * time.Millisecond)
+	balancer.TickOnce()
+	assert.Greater(t, balancer.GetQueueStats().DropRate, 0.0)
+	assert.Equal(t, 0.0, balancer.GetQueueStats().EnqueueRate)
+
+	close(unblock)
+	wg.Wait()
+}
+
+func TestWithCost(t *testing.T) {
+	unblock := make(chan struct{})
+	started := make(chan int, 3)
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			started <- param
+			<-unblock
+			return param, nil
+		},
+	})
+	balancer.MaxInFlight = 3
+
+	dispatch := func(ctx context.Context, param int) chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := balancer.Dispatch(ctx, param)
+			done <- err
+		}()
+		return done
+	}
+	running := dispatch(context.Background(), 0)
+	assert.Equal(t, 0, <-started)
+
+	// Two slots are left, not enough for a dispatch costing three
+	expensive := dispatch(lb.WithCost(context.Background(), 3), 1)
+	assert.Eventually(t, func() bool {
+		return balancer.GetQueueStats().Depth == 1
+	}, time.Second, time.Millisecond)
+
+	// Nor for a cheap one behind it, slots go in order
+	cheap := dispatch(context.Background(), 2)
+	assert.Eventually(t, func() bool {
+		return balancer.GetQueueStats().Depth == 2
+	}, time.Second, time.Millisecond)
+
+	close(unblock)
+	assert.NoError(t, <-running)
+	assert.NoError(t, <-expensive)
+	assert.NoError(t, <-cheap)
+	assert.Equal(t, 1, <-started)
+	assert.Equal(t, 2, <-started)
+
+	// Costs above the limit take every slot instead of waiting forever
+	_, err := balancer.Dispatch(lb.WithCost(context.Background(), 10), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, balancer.GetQueueStats().InFlight)
+}
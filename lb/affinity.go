@@ -0,0 +1,28 @@
+package lb
+
+import "time"
+
+// Returns the handler that last succeeded for key, along with the set it is
+// in, if it is still there and healthy enough to prefer: it has some weight
+// and isn't out of quota or cooling down.
+func (l *LoadBalancer[T, U]) stickTo(key string) (*handlerSet[T, U], int, bool) {
+	id, ok := l.affinity.get(key, time.Now())
+	if !ok {
+		return nil, 0, false
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	index, ok := l.find(id)
+	if !ok || l.weights[index] <= 0 || !l.routable(index, l.now(), true) {
+		return nil, 0, false
+	}
+	l.affinityHits.Add(1)
+	return l.handlerSet, index, true
+}
+
+// Returns the number of dispatches sent to the handler that last succeeded for
+// their key, see [LoadBalancer.AffinityKey].
+func (l *LoadBalancer[T, U]) AffinityHits() int64 {
+	return l.affinityHits.Load()
+}
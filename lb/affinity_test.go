@@ -0,0 +1,58 @@
+package lb_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAffinity(t *testing.T) {
+	var chosen []int
+	failing := false
+	handler := func(ctx context.Context, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		chosen = append(chosen, info.Index)
+		if failing && info.Index == 0 {
+			return 0, lb.ErrExceedCap
+		}
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	balancer.Deflect = true
+	balancer.BackoffUnit = time.Millisecond
+	balancer.AffinityKey = func(param int) (string, bool) {
+		return strconv.Itoa(param), param >= 0
+	}
+
+	// Key 1 lands on 0 then sticks to it, unlike keyless requests
+	for range 3 {
+		balancer.Dispatch(context.Background(), 1)
+	}
+	balancer.Dispatch(context.Background(), -1)
+	balancer.Dispatch(context.Background(), -1)
+	assert.Equal(t, []int{0, 0, 0, 1, 0}, chosen)
+	assert.Equal(t, int64(2), balancer.AffinityHits())
+
+	// Once 0 rejects calls, key 1 moves to 1 and sticks there
+	failing = true
+	chosen = nil
+	balancer.Dispatch(context.Background(), 1)
+	failing = false
+	balancer.Dispatch(context.Background(), 1)
+	assert.Equal(t, []int{0, 1, 1}, chosen)
+
+	// Handlers without weight are passed over
+	time.Sleep(5 * time.Millisecond)
+	chosen = nil
+	balancer.SetAllCapacities([]float64{1000, 0.1})
+	balancer.Dispatch(context.Background(), 1)
+	assert.Equal(t, []int{0}, chosen)
+}
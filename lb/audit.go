@@ -0,0 +1,132 @@
+package lb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// A change made to the load balancer at runtime, see [LoadBalancer.AuditLog].
+type AuditEvent struct {
+	Time time.Time `json:"time"`
+	// Who made the change, see [WithActor]. Empty for changes made through
+	// methods that don't take a context.
+	Actor string `json:"actor,omitempty"`
+	// What was done, e.g. "update_config" or "set_capacities"
+	Action string `json:"action"`
+	// Everything that changed as a result
+	Changes []Change `json:"changes"`
+}
+
+// A value that changed, see [AuditEvent].
+type Change struct {
+	// Name of the [Config] field, or one of "capacities", "weights",
+	// "weight_hints" and "strategy"
+	Field  string `json:"field"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+type actorKey struct{}
+
+// Returns a context that attributes changes made with it to actor in the
+// [LoadBalancer.AuditLog], e.g. the user of an admin endpoint.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actor(ctx context.Context) string {
+	a, _ := ctx.Value(actorKey{}).(string)
+	return a
+}
+
+// Everything an audit event compares.
+type auditState struct {
+	config   Config
+	caps     []float64
+	hints    []float64
+	weights  []int
+	strategy string
+}
+
+// Needs the lock.
+func (l *LoadBalancer[T, U]) auditState() auditState {
+	return auditState{
+		config:   l.Config,
+		caps:     slices.Clone(l.caps),
+		hints:    slices.Clone(l.hints),
+		weights:  slices.Clone(l.WeightedRoundRobin.GetWeights()),
+		strategy: fmt.Sprintf("%T", l.strategy),
+	}
+}
+
+// Adds an event for what changed since before to the audit log, if anything
+// did. Needs the lock.
+func (l *LoadBalancer[T, U]) record(action string, actor string, before auditState) {
+	if l.AuditLogSize <= 0 {
+		return
+	}
+	after := l.auditState()
+	changes := diffConfig(before.config, after.config)
+	for _, c := range []Change{
+		{"capacities", before.caps, after.caps},
+		{"weight_hints", before.hints, after.hints},
+		{"weights", before.weights, after.weights},
+		{"strategy", before.strategy, after.strategy},
+	} {
+		if !reflect.DeepEqual(c.Before, c.After) {
+			changes = append(changes, c)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	l.audit.add(l.AuditLogSize, AuditEvent{
+		Time:    time.Now(),
+		Actor:   actor,
+		Action:  action,
+		Changes: changes,
+	})
+}
+
+// Returns the fields of the config that differ, skipping those left out of
+// JSON dumps such as callbacks.
+func diffConfig(before, after Config) []Change {
+	var changes []Change
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := range b.NumField() {
+		field := b.Type().Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		if bv, av := b.Field(i).Interface(), a.Field(i).Interface(); !reflect.DeepEqual(bv, av) {
+			changes = append(changes, Change{Field: field.Name, Before: bv, After: av})
+		}
+	}
+	return changes
+}
+
+// Changes the config at runtime, recording the change in the
+// [LoadBalancer.AuditLog] under the actor of ctx, see [WithActor]. The update
+// holds the lock of the update cycle and the weights are rebalanced right
+// away, but fields read while dispatching are still subject to the caveat on
+// [Config].
+func (l *LoadBalancer[T, U]) UpdateConfig(ctx context.Context, update func(c *Config)) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	before := l.auditState()
+	update(&l.Config)
+	l.updateWeights()
+	l.record("update_config", actor(ctx), before)
+}
+
+// Returns the last [Config.AuditLogSize] changes made at runtime, from oldest
+// to newest: config updates, capacities and weight hints set by hand,
+// restored snapshots and strategy changes.
+func (l *LoadBalancer[T, U]) AuditLog() []AuditEvent {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.audit.list()
+}
@@ -0,0 +1,52 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+	balancer.AuditLogSize = 2
+
+	ctx := lb.WithActor(context.Background(), "alice")
+	balancer.UpdateConfig(ctx, func(c *lb.Config) {
+		c.BackoffUnit = time.Second
+		c.OnTick = func(lb.TickReport) {}
+	})
+	log := balancer.AuditLog()
+	assert.Len(t, log, 1)
+	assert.Equal(t, "alice", log[0].Actor)
+	assert.Equal(t, "update_config", log[0].Action)
+	assert.Equal(t, []lb.Change{{
+		Field:  "BackoffUnit",
+		Before: lb.DefaultConfig().BackoffUnit,
+		After:  time.Second,
+	}}, log[0].Changes)
+
+	// No-op changes aren't recorded
+	balancer.UpdateConfig(ctx, func(c *lb.Config) {})
+	assert.Len(t, balancer.AuditLog(), 1)
+
+	assert.NoError(t, balancer.SetAllCapacities([]float64{1, 3}))
+	log = balancer.AuditLog()
+	assert.Len(t, log, 2)
+	assert.Empty(t, log[1].Actor)
+	assert.Equal(t, "set_capacities", log[1].Action)
+	assert.Equal(t, []lb.Change{
+		{Field: "capacities", Before: []float64{1, 1}, After: []float64{1, 3}},
+		{Field: "weights", Before: []int{50, 50}, After: []int{25, 75}},
+	}, log[1].Changes)
+
+	// Only the last AuditLogSize are kept
+	balancer.SetWeightHints([]float64{1, 1})
+	log = balancer.AuditLog()
+	assert.Len(t, log, 2)
+	assert.Equal(t, "set_capacities", log[0].Action)
+	assert.Equal(t, "set_weight_hints", log[1].Action)
+}
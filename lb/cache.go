@@ -0,0 +1,111 @@
+package lb
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type cacheEntry[U any] struct {
+	key     string
+	res     U
+	expires time.Time
+}
+
+// Bounded map of responses, evicting the oldest entries first. The zero value
+// is ready to use.
+type cache[U any] struct {
+	entries map[string]*list.Element
+	order   list.List // of *cacheEntry[U], oldest first
+	hits    atomic.Int64
+	mut     sync.Mutex
+}
+
+func (c *cache[U]) get(key string, now time.Time) (U, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	var res U
+	elem, ok := c.entries[key]
+	if !ok {
+		return res, false
+	}
+	entry := elem.Value.(*cacheEntry[U])
+	if !now.Before(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return res, false
+	}
+	c.hits.Add(1)
+	return entry.res, true
+}
+
+func (c *cache[U]) put(key string, res U, expires time.Time, size int) {
+	if size <= 0 {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+	}
+	for c.order.Len() >= size {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry[U]).key)
+	}
+	c.entries[key] = c.order.PushBack(&cacheEntry[U]{
+		key:     key,
+		res:     res,
+		expires: expires,
+	})
+}
+
+// Removes every entry whose response matches.
+func (c *cache[U]) removeIf(match func(U) bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if entry := elem.Value.(*cacheEntry[U]); match(entry.res) {
+			c.order.Remove(elem)
+			delete(c.entries, entry.key)
+		}
+		elem = next
+	}
+}
+
+// Returned by [LoadBalancer.Dispatch], wrapping the error of the original
+// dispatch, when a key failed recently and is not tried again yet, see
+// [Config.NegativeCacheTTL].
+var ErrCachedFailure = errors.New("lb cached failure")
+
+// Whether err says the request itself is hopeless, rather than that no handler
+// could take it right now or that the caller gave up.
+func hardFailure(err error) bool {
+	for _, transient := range []error{
+		ErrExceedCap, ErrQuotaExhausted, ErrShed, ErrShuttingDown, ErrNoHandlers, ErrUnavailable,
+		context.Canceled, context.DeadlineExceeded,
+	} {
+		if errors.Is(err, transient) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the number of dispatches served from the cache, see
+// [LoadBalancer.CacheKey]. These never reach a handler, so they are not
+// counted towards any handler's capacity.
+func (l *LoadBalancer[T, U]) CacheHits() int64 {
+	return l.cache.hits.Load()
+}
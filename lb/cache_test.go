@@ -0,0 +1,132 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			return param * 2, nil
+		},
+	})
+	balancer.CacheTTL = 50 * time.Millisecond
+	balancer.CacheSize = 2
+	balancer.CacheKey = func(param int) (string, bool) {
+		// don't cache negative params
+		return strconv.Itoa(param), param >= 0
+	}
+
+	for range 3 {
+		res, err := balancer.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, res)
+	}
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(2), balancer.CacheHits())
+
+	for range 3 {
+		balancer.Dispatch(context.Background(), -1)
+	}
+	assert.Equal(t, 4, calls)
+
+	// pushes 1 out of the cache
+	balancer.Dispatch(context.Background(), 2)
+	balancer.Dispatch(context.Background(), 3)
+	balancer.Dispatch(context.Background(), 1)
+	assert.Equal(t, 7, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	balancer.Dispatch(context.Background(), 1)
+	assert.Equal(t, 8, calls)
+	assert.Equal(t, int64(2), balancer.CacheHits())
+}
+
+func TestNegativeCache(t *testing.T) {
+	errGone := errors.New("gone")
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			switch param {
+			case 1:
+				return 0, errGone
+			case 2:
+				return 0, context.Canceled
+			}
+			return param, nil
+		},
+	})
+	balancer.NegativeCacheTTL = 50 * time.Millisecond
+	balancer.CacheKey = func(param int) (string, bool) {
+		return strconv.Itoa(param), true
+	}
+
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, errGone)
+	assert.NotErrorIs(t, err, lb.ErrCachedFailure)
+	for range 2 {
+		_, err = balancer.Dispatch(context.Background(), 1)
+		assert.ErrorIs(t, err, errGone)
+		assert.ErrorIs(t, err, lb.ErrCachedFailure)
+	}
+	assert.Equal(t, 1, calls)
+
+	// Only hard failures are remembered
+	balancer.Dispatch(context.Background(), 2)
+	balancer.Dispatch(context.Background(), 2)
+	assert.Equal(t, 3, calls)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = balancer.Dispatch(context.Background(), 1)
+	assert.NotErrorIs(t, err, lb.ErrCachedFailure)
+	assert.Equal(t, 4, calls)
+}
+
+func TestNegativeCacheHandlerErrorsOnly(t *testing.T) {
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap:  1,
+		MaxRate: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			return param, nil
+		},
+	})
+	balancer.NegativeCacheTTL = time.Minute
+	balancer.CacheKey = func(param int) (string, bool) {
+		return strconv.Itoa(param), true
+	}
+
+	// Use up the rate limit so the next call has to wait past its deadline
+	balancer.Dispatch(context.Background(), 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := balancer.Dispatch(ctx, 1)
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	// Aborted before reaching the handler
+	errAbort := errors.New("abort")
+	_, err = balancer.DispatchWithOpts(context.Background(), 1, lb.DispatchOpts{
+		OnAttempt: func(attempt, index int) error { return errAbort },
+	})
+	assert.ErrorIs(t, err, errAbort)
+
+	// Neither said anything about the request
+	res, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+	assert.Equal(t, 2, calls)
+}
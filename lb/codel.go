@@ -0,0 +1,48 @@
+package lb
+
+import (
+	"math"
+	"time"
+)
+
+// State of the controlled delay (CoDel) queue management under
+// [Config.CoDelTarget]. Once dispatches have been waiting longer than the
+// target for a whole interval, waiting dispatches are dropped as they come up,
+// at a rate that increases with the square root of the drops so far, until the
+// wait is back under the target.
+type codel struct {
+	firstAbove time.Time // when the wait will have been above target for an interval
+	dropping   bool
+	dropNext   time.Time // when to drop next while dropping
+	drops      int       // drops since dropping started
+}
+
+// Whether to drop a dispatch that waited for sojourn and is about to be handed
+// a slot. Needs the admission lock.
+func (c *codel) drop(target, interval time.Duration, now time.Time, sojourn time.Duration) bool {
+	if target <= 0 || sojourn < target {
+		c.firstAbove = time.Time{}
+		c.dropping = false
+		return false
+	}
+	if c.firstAbove.IsZero() {
+		c.firstAbove = now.Add(interval)
+		return false
+	}
+	if now.Before(c.firstAbove) {
+		return false
+	}
+
+	if !c.dropping {
+		c.dropping = true
+		c.drops = 1
+		c.dropNext = now.Add(interval)
+		return true
+	}
+	if now.Before(c.dropNext) {
+		return false
+	}
+	c.drops++
+	c.dropNext = now.Add(time.Duration(float64(interval) / math.Sqrt(float64(c.drops))))
+	return true
+}
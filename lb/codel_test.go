@@ -0,0 +1,46 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoDel(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedNewest)
+	balancer.MaxQueue = 0
+	balancer.CoDelTarget = 5 * time.Millisecond
+	balancer.CoDelInterval = 20 * time.Millisecond
+
+	running := dispatchAsync(balancer, context.Background())
+	var queued []chan error
+	for range 5 {
+		queued = append(queued, dispatchAsync(balancer, context.Background()))
+	}
+
+	// Everyone has been waiting well over the target, but dropping only
+	// starts once that has gone on for an interval
+	time.Sleep(30 * time.Millisecond)
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	time.Sleep(30 * time.Millisecond)
+	gate <- struct{}{}
+	assert.NoError(t, <-queued[0])
+
+	close(gate)
+
+	shed := 0
+	for _, done := range queued[1:] {
+		if err := <-done; errors.Is(err, lb.ErrShed) {
+			shed++
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	assert.Positive(t, shed)
+	assert.Equal(t, int64(shed), balancer.GetQueueStats().Dropped)
+}
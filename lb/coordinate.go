@@ -0,0 +1,156 @@
+package lb
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Shares what load balancer instances see of their handlers, so that many
+// instances in front of the same handlers (e.g. one per client pod) learn from
+// their combined traffic instead of just their own slice of it. Handlers are
+// matched by [Handler.Name], unnamed handlers are never shared.
+//
+// Implementations backed by a remote store (e.g. Redis or gossip) should keep
+// Exchange short, it is called once every tick.
+type Coordinator interface {
+	// Publishes the samples the given instance took this tick, keyed by
+	// handler name, and returns the combined samples of every live instance
+	// including this one. Handlers missing from the result keep their local
+	// sample.
+	Exchange(instance string, samples map[string]Sample) (map[string]Sample, error)
+}
+
+// Replaces the local samples with the combined samples of every instance. If
+// the exchange fails the local samples are used as is.
+func (l *LoadBalancer[T, U]) coordinate(s *handlerSet[T, U], samples []*Sample) []*Sample {
+	local := make(map[string]Sample)
+	for i, sample := range samples {
+		if sample != nil && s.names[i] != "" {
+			local[s.names[i]] = *sample
+		}
+	}
+
+	instance := l.InstanceID
+	if instance == "" {
+		instance = l.instanceID
+	}
+	combined, err := l.Coordinator.Exchange(instance, local)
+	if err != nil {
+		return samples
+	}
+
+	for i, sample := range samples {
+		if sample == nil || s.names[i] == "" {
+			continue
+		}
+		if c, ok := combined[s.names[i]]; ok {
+			samples[i] = &c
+		}
+	}
+	return samples
+}
+
+// A [Coordinator] for load balancers within the same process, mostly useful for
+// tests and simulations.
+type MemoryCoordinator struct {
+	staleAfter time.Duration
+
+	mut       sync.Mutex
+	instances map[string]memoryInstance
+}
+
+type memoryInstance struct {
+	samples map[string]Sample
+	seen    time.Time
+}
+
+// Creates a coordinator that forgets instances which haven't exchanged samples
+// for staleAfter, e.g. a few update intervals.
+func NewMemoryCoordinator(staleAfter time.Duration) *MemoryCoordinator {
+	return &MemoryCoordinator{
+		staleAfter: staleAfter,
+		instances:  make(map[string]memoryInstance),
+	}
+}
+
+func (m *MemoryCoordinator) Exchange(instance string, samples map[string]Sample) (map[string]Sample, error) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	now := time.Now()
+	m.instances[instance] = memoryInstance{samples: samples, seen: now}
+
+	combined := make(map[string]Sample)
+	for id, inst := range m.instances {
+		if now.Sub(inst.seen) > m.staleAfter {
+			delete(m.instances, id)
+			continue
+		}
+		for name, s := range inst.samples {
+			combined[name] = combineSamples(combined[name], s)
+		}
+	}
+	return combined, nil
+}
+
+// Adds up two samples of the same handler taken by different instances.
+func combineSamples(a, b Sample) Sample {
+	calls := a.Calls + b.Calls
+	var latency time.Duration
+	if calls > 0 {
+		latency = time.Duration((float64(a.Latency)*a.Calls + float64(b.Latency)*b.Calls) / calls)
+	}
+	return Sample{
+		Calls:      calls,
+		Errors:     a.Errors + b.Errors,
+		Rejections: a.Rejections + b.Rejections,
+		Latency:    latency,
+		InFlight:   a.InFlight + b.InFlight,
+		Period:     max(a.Period, b.Period),
+	}
+}
+
+// Implemented by a [Coordinator] that knows how many instances are live, so
+// they can split the quota of each handler with [Config.LeaseQuota].
+type InstanceCounter interface {
+	// Returns the number of live instances, including this one.
+	Instances() int
+}
+
+// Returns the number of instances that exchanged samples recently.
+func (m *MemoryCoordinator) Instances() int {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, inst := range m.instances {
+		if now.Sub(inst.seen) <= m.staleAfter {
+			n++
+		}
+	}
+	return n
+}
+
+// Returns the fraction of each handler's hard limit this instance may use.
+func (l *LoadBalancer[T, U]) quotaShare() float64 {
+	if counter, ok := l.Coordinator.(InstanceCounter); ok && l.LeaseQuota {
+		return 1 / float64(max(counter.Instances(), 1))
+	}
+	if l.QuotaShare > 0 && l.QuotaShare < 1 {
+		return l.QuotaShare
+	}
+	return 1
+}
+
+// Paces the handlers of s with a hard limit at this instance's share of it.
+func (l *LoadBalancer[T, U]) shareQuota(s *handlerSet[T, U]) {
+	share := l.quotaShare()
+	for i, limiter := range s.limiters {
+		if limiter != nil {
+			limiter.SetLimit(rate.Limit(s.maxRates[i] * share))
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNamedBalancer(coordinator lb.Coordinator) *lb.LoadBalancer[int, int] {
+	handler := func(ctx context.Context, param int) (int, error) {
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{Name: "b", EstCap: 10, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	balancer.Coordinator = coordinator
+	return balancer
+}
+
+func TestCoordinatorSharesTraffic(t *testing.T) {
+	coordinator := lb.NewMemoryCoordinator(time.Minute)
+	busy := newNamedBalancer(coordinator)
+	idle := newNamedBalancer(coordinator)
+	alone := newNamedBalancer(nil)
+
+	for i := range 100 {
+		_, err := busy.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+	}
+	busy.TickOnce()
+	idle.TickOnce()
+	alone.TickOnce()
+
+	// The idle instance learned from the busy one's traffic, the one without
+	// a coordinator only saw its own lack of traffic.
+	assert.Equal(t, busy.GetCapacities(), idle.GetCapacities())
+	assert.NotEqual(t, alone.GetCapacities(), idle.GetCapacities())
+}
+
+func TestMemoryCoordinatorCombines(t *testing.T) {
+	coordinator := lb.NewMemoryCoordinator(time.Minute)
+
+	_, err := coordinator.Exchange("x", map[string]lb.Sample{
+		"a": {Calls: 10, Errors: 1, Latency: time.Second, Period: time.Second},
+	})
+	assert.NoError(t, err)
+	combined, err := coordinator.Exchange("y", map[string]lb.Sample{
+		"a": {Calls: 30, Rejections: 2, Latency: 3 * time.Second, Period: time.Second},
+		"b": {Calls: 5, Period: time.Second},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, lb.Sample{
+		Calls:      40,
+		Errors:     1,
+		Rejections: 2,
+		Latency:    2500 * time.Millisecond,
+		Period:     time.Second,
+	}, combined["a"])
+	assert.Equal(t, 5.0, combined["b"].Calls)
+
+	// Republishing replaces the instance's previous samples.
+	combined, err = coordinator.Exchange("x", map[string]lb.Sample{})
+	assert.NoError(t, err)
+	assert.Equal(t, 30.0, combined["a"].Calls)
+}
+
+func TestMemoryCoordinatorForgetsStale(t *testing.T) {
+	coordinator := lb.NewMemoryCoordinator(0)
+
+	_, err := coordinator.Exchange("x", map[string]lb.Sample{"a": {Calls: 10}})
+	assert.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	combined, err := coordinator.Exchange("y", map[string]lb.Sample{})
+	assert.NoError(t, err)
+	assert.NotContains(t, combined, "a")
+}
+
+func newLimitedBalancer(coordinator lb.Coordinator) *lb.LoadBalancer[int, int] {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		Name:    "a",
+		EstCap:  10,
+		MaxRate: 200,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.Coordinator = coordinator
+	return balancer
+}
+
+// Times n dispatches, which are paced by the handler's share of its MaxRate.
+func timeDispatches(balancer *lb.LoadBalancer[int, int], n int) time.Duration {
+	start := time.Now()
+	for i := range n {
+		balancer.Dispatch(context.Background(), i)
+	}
+	return time.Since(start)
+}
+
+func TestQuotaShare(t *testing.T) {
+	balancer := newLimitedBalancer(nil)
+	balancer.QuotaShare = 0.25
+	balancer.TickOnce()
+
+	// 50 per second, the first call goes through immediately
+	assert.GreaterOrEqual(t, timeDispatches(balancer, 6), 90*time.Millisecond)
+}
+
+func TestLeaseQuota(t *testing.T) {
+	coordinator := lb.NewMemoryCoordinator(time.Minute)
+	first := newLimitedBalancer(coordinator)
+	second := newLimitedBalancer(coordinator)
+	first.LeaseQuota = true
+	second.LeaseQuota = true
+
+	first.TickOnce()
+	second.TickOnce()
+	first.TickOnce()
+	assert.Equal(t, 2, coordinator.Instances())
+
+	// 100 per second each, the first call goes through immediately
+	assert.GreaterOrEqual(t, timeDispatches(first, 11), 90*time.Millisecond)
+}
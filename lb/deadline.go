@@ -0,0 +1,39 @@
+package lb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Derives the context of an attempt on a handler. With [Config.DeadlineMargin]
+// set, the attempt must finish early enough to leave time for backing off for
+// backoff and retrying before the caller's deadline. If there wouldn't be time
+// to retry anyway, or retries are disabled, the attempt gets all the remaining
+// time.
+func (l *LoadBalancer[T, U]) attemptContext(ctx context.Context, backoff time.Duration, retry bool) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok || !retry || l.DeadlineMargin <= 0 {
+		return ctx, func() {}
+	}
+
+	deadline = deadline.Add(-backoff - l.DeadlineMargin)
+	if !deadline.After(time.Now()) {
+		return ctx, func() {}
+	}
+	return context.WithDeadlineCause(ctx, deadline, errAttemptDeadline)
+}
+
+// Cause of the context of an attempt running out of its share of the time, as
+// opposed to the caller's context ending.
+var errAttemptDeadline = errors.New("lb attempt deadline")
+
+// Whether the call failed because the caller gave up on it rather than because
+// of the handler: ctx ended, other than by its attempt deadline, and the error
+// came from that. Such calls say nothing about the handler.
+func cancelled(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() == nil || context.Cause(ctx) == errAttemptDeadline {
+		return false
+	}
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
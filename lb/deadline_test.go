@@ -0,0 +1,114 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadlineMargin(t *testing.T) {
+	var deadlines []time.Duration
+	handler := func(ctx context.Context, param int) (int, error) {
+		deadline, _ := ctx.Deadline()
+		deadlines = append(deadlines, time.Until(deadline))
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{EstCap: 1, Dispatch: handler})
+	balancer.BackoffUnit = 10 * time.Millisecond
+	balancer.DeadlineMargin = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := balancer.Dispatch(ctx, 0)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The first attempt leaves time to retry, the retry gets the rest.
+	assert.Len(t, deadlines, 2)
+	assert.InDelta(t, 890*time.Millisecond, deadlines[0], float64(50*time.Millisecond))
+	assert.InDelta(t, 110*time.Millisecond, deadlines[1], float64(50*time.Millisecond))
+}
+
+func TestDeadlineMarginFailsOver(t *testing.T) {
+	slow := lb.Handler[int, int]{
+		Name:   "slow",
+		EstCap: 100,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+	}
+	fast := lb.Handler[int, int]{
+		Name:   "fast",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 1, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(slow, fast)
+	balancer.ExplorationRate = 0
+	balancer.BackoffUnit = 10 * time.Millisecond
+	balancer.DeadlineMargin = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	res, err := balancer.Dispatch(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+}
+
+func TestDeadlineMarginNoRetry(t *testing.T) {
+	var remaining time.Duration
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			deadline, _ := ctx.Deadline()
+			remaining = time.Until(deadline)
+			return 0, nil
+		},
+	})
+	balancer.DeadlineMargin = 100 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := balancer.Dispatch(lb.NoRetry(ctx), 0)
+	assert.NoError(t, err)
+	assert.Greater(t, remaining, 900*time.Millisecond)
+}
+
+// Tests that calls the caller gave up on don't count against the handler.
+func TestCallerCancellation(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		Name:   "slow",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		},
+	})
+	balancer.ErrorPenaltyHalfLife = time.Second
+	var events []lb.TraceEvent
+	balancer.OnTrace = func(e lb.TraceEvent) {
+		events = append(events, e)
+	}
+	assert.NoError(t, balancer.Trace("slow", time.Minute))
+
+	for range 3 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		_, err := balancer.Dispatch(ctx, 0)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	balancer.TickOnce()
+
+	stats := balancer.GetStats()[0]
+	assert.Zero(t, stats.Penalty)
+	assert.Zero(t, stats.Latency)
+	assert.Len(t, events, 3)
+	for _, e := range events {
+		assert.Equal(t, lb.OutcomeCancelled, e.Outcome)
+	}
+}
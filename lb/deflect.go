@@ -0,0 +1,42 @@
+package lb
+
+import (
+	"errors"
+	"time"
+)
+
+// Returned by tryDispatch when a rejected call should be sent to another
+// handler instead of waiting out the backoff. Never returned to callers.
+var errDeflected = errors.New("lb deflected")
+
+// Whether handler i is cooling down after rejecting a call.
+func (s *handlerSet[T, U]) coolingDown(i int, now time.Time) bool {
+	return now.UnixNano() < s.coolDownUntil[i].Load()
+}
+
+// Marks handler i as cooling down for at least d from now. Concurrent cool
+// downs don't shorten each other.
+func (s *handlerSet[T, U]) coolDown(i int, now time.Time, d time.Duration) {
+	until := now.Add(d).UnixNano()
+	for old := s.coolDownUntil[i].Load(); until > old; old = s.coolDownUntil[i].Load() {
+		if s.coolDownUntil[i].CompareAndSwap(old, until) {
+			return
+		}
+	}
+}
+
+// Whether handler i can be dispatched to now. Handlers cooling down are only
+// avoided if asked to.
+func (s *handlerSet[T, U]) routable(i int, now time.Time, avoidCoolDown bool) bool {
+	return !s.exhausted(i, now) && !(avoidCoolDown && s.coolingDown(i, now))
+}
+
+// Whether some handler other than i could take a call right away.
+func (s *handlerSet[T, U]) canDeflect(i int, now time.Time) bool {
+	for j := range s.dispatch {
+		if j != i && s.routable(j, now, true) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package lb_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that with deflection on, calls rejected by a handler go straight to
+// another handler instead of waiting out the backoff.
+func TestDeflect(t *testing.T) {
+	var rejecting, accepting atomic.Int32
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				rejecting.Add(1)
+				return 0, lb.ErrExceedCap
+			},
+		},
+		lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				accepting.Add(1)
+				return 1, nil
+			},
+		},
+	)
+	balancer.ExplorationRate = 0
+	balancer.BackoffUnit = time.Second
+	balancer.Deflect = true
+
+	start := time.Now()
+	for range 10 {
+		res, err := balancer.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	}
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, int32(10), accepting.Load())
+	// the first rejection puts it in cool down, after which it is avoided
+	assert.Equal(t, int32(1), rejecting.Load())
+	assert.Equal(t, int64(1), balancer.GetStats()[0].Deflections)
+}
+
+// Tests that when everyone is cooling down, calls wait as usual.
+func TestDeflectNowhereToGo(t *testing.T) {
+	var calls atomic.Int32
+	handler := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			if calls.Add(1) <= 2 {
+				return 0, lb.ErrExceedCap
+			}
+			return 1, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler, handler)
+	balancer.ExplorationRate = 0
+	balancer.BackoffUnit = 20 * time.Millisecond
+	balancer.Deflect = true
+
+	start := time.Now()
+	res, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.Equal(t, int32(3), calls.Load())
+}
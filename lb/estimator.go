@@ -0,0 +1,171 @@
+package lb
+
+import "time"
+
+// What was observed of a single handler over some period, usually one update
+// interval.
+type Sample struct {
+	// Number of tasks the handler completed, including failed ones
+	Calls float64
+	// Number of those tasks that failed with an error other than
+	// [ErrExceedCap]
+	Errors float64
+	// Number of times the handler returned [ErrExceedCap]
+	Rejections float64
+	// Average time the completed tasks took
+	Latency time.Duration
+	// Most tasks the handler was running at once
+	InFlight int
+	// Length of the period the sample covers
+	Period time.Duration
+}
+
+// Estimates the capacity of a single handler from samples of what it did. Each
+// handler gets its own instance from [Config.Estimator], so implementations may
+// keep per handler state and need not be safe for concurrent use.
+type Estimator interface {
+	// Returns the new capacity estimate, in tasks per second, given the
+	// current estimate and the latest sample. Called once per update
+	// interval.
+	Estimate(c *Config, capacity float64, s Sample) float64
+}
+
+// How calls that failed with an error other than [ErrExceedCap] count towards
+// a handler's capacity, see [Config.ErrorPolicy].
+type ErrorPolicy int
+
+const (
+	// Failed calls count like successful ones. Simple, but a handler that
+	// quickly fails everything looks like it has a lot of capacity.
+	ErrorsAsCalls ErrorPolicy = iota
+	// Only successful calls count, capacity is estimated from goodput.
+	ErrorsIgnored
+	// Failed calls count as rejections, so a failing handler's capacity
+	// shrinks as if it was overloaded.
+	ErrorsAsRejections
+)
+
+// Returns the sample as the built in estimators should see it, with the failed
+// calls counted as per [Config.ErrorPolicy].
+func (c *Config) applyErrorPolicy(s Sample) Sample {
+	policy := c.ErrorPolicy
+	if c.WeightByGoodput {
+		policy = ErrorsIgnored
+	}
+	switch policy {
+	case ErrorsIgnored:
+		s.Calls -= s.Errors
+	case ErrorsAsRejections:
+		s.Calls -= s.Errors
+		s.Rejections += s.Errors
+	}
+	return s
+}
+
+// The default estimator. Additively increases the capacity of handlers that
+// completed calls, multiplicatively decreases it for handlers that rejected
+// calls, then smooths it towards the observed rate. See the AIMD*,
+// SmoothingFactor and ErrorPolicy fields of [Config].
+type AIMD struct{}
+
+func (AIMD) Estimate(c *Config, capacity float64, s Sample) float64 {
+	s = c.applyErrorPolicy(s)
+
+	// AIMD: additive increase for successes
+	if s.Calls > 0 {
+		capacity += c.AIMDIncrease
+	}
+
+	// AIMD: multiplicative decrease for rejections
+	if s.Rejections > 0 {
+		capacity *= c.AIMDDecreaseFactor
+	}
+
+	// Exponential smoothing for observed rate
+	if s.Calls > 0 || s.Rejections > 0 {
+		estCap := s.Calls / s.Period.Seconds()
+		capacity = c.SmoothingFactor*estCap + (1-c.SmoothingFactor)*capacity
+	}
+
+	// Decay for idle handlers to prevent starvation
+	if s.Calls == 0 && s.Rejections == 0 {
+		capacity *= 0.99
+	}
+
+	return capacity
+}
+
+// Returns the estimator of handler i, creating it if needed. Needs the lock.
+func (l *LoadBalancer[T, U]) estimator(i int) Estimator {
+	if l.estimators[i] == nil {
+		if l.Estimator != nil {
+			l.estimators[i] = l.Estimator()
+		} else {
+			l.estimators[i] = AIMD{}
+		}
+	}
+	return l.estimators[i]
+}
+
+// Returns a [Config.Estimator] that estimates capacity as the plain average of
+// the observed rate (counted as per [Config.ErrorPolicy]) over the last n
+// update intervals in which the handler was called. Easier to reason about than
+// [AIMD], at the cost of reacting more slowly to sudden changes.
+func NewWindowAverage(n int) func() Estimator {
+	return func() Estimator {
+		return &windowAverage{rates: make([]float64, max(n, 1))}
+	}
+}
+
+type windowAverage struct {
+	rates []float64 // ring buffer of observed rates
+	next  int
+	count int
+}
+
+func (w *windowAverage) Estimate(c *Config, capacity float64, s Sample) float64 {
+	if s.Calls == 0 && s.Rejections == 0 {
+		// Nothing observed, nothing to average in.
+		return capacity
+	}
+
+	w.rates[w.next] = c.applyErrorPolicy(s).Calls / s.Period.Seconds()
+	w.next = (w.next + 1) % len(w.rates)
+	w.count = min(w.count+1, len(w.rates))
+
+	total := 0.0
+	for _, r := range w.rates[:w.count] {
+		total += r
+	}
+	return total / float64(w.count)
+}
+
+// Returns a [Config.Estimator] that derives capacity from latency using
+// Little's law: a handler that can run concurrency tasks at once, each taking
+// the average latency, completes concurrency / latency tasks per second. Useful
+// for backends where you control concurrency rather than rate. If concurrency
+// is 0 the most tasks observed running at once is used instead. The result is
+// smoothed with [Config.SmoothingFactor].
+func NewLittlesLaw(concurrency int) func() Estimator {
+	return func() Estimator {
+		return littlesLaw{concurrency: concurrency}
+	}
+}
+
+type littlesLaw struct {
+	concurrency int
+}
+
+func (e littlesLaw) Estimate(c *Config, capacity float64, s Sample) float64 {
+	concurrency := e.concurrency
+	if concurrency <= 0 {
+		concurrency = s.InFlight
+	}
+	if s.Latency <= 0 || concurrency <= 0 {
+		// Nothing completed, nothing to go on.
+		return capacity
+	}
+
+	estCap := float64(concurrency) / s.Latency.Seconds()
+	return c.SmoothingFactor*estCap + (1-c.SmoothingFactor)*capacity
+}
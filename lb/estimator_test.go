@@ -0,0 +1,88 @@
+package lb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowAverage(t *testing.T) {
+	balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1)...)
+	balancer.Estimator = lb.NewWindowAverage(3)
+
+	balancer.Seed([]lb.Observation{{Handler: 0, Calls: 3}})
+	assert.Equal(t, []float64{3}, balancer.GetCapacities())
+
+	balancer.Seed([]lb.Observation{
+		{Handler: 0, Calls: 6},
+		{Handler: 0},
+		{Handler: 0, Calls: 9},
+	})
+	assert.Equal(t, []float64{6}, balancer.GetCapacities())
+
+	// the 3 falls out of the window
+	balancer.Seed([]lb.Observation{{Handler: 0, Calls: 12}})
+	assert.Equal(t, []float64{9}, balancer.GetCapacities())
+}
+
+// Tests the estimator end to end with handlers of different latencies and
+// concurrency limits.
+func TestLittlesLawDispatch(t *testing.T) {
+	handler := func(latency time.Duration) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				time.Sleep(latency)
+				return param, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler(10*time.Millisecond), handler(40*time.Millisecond))
+	balancer.Estimator = lb.NewLittlesLaw(4)
+	balancer.SmoothingFactor = 1
+	balancer.ExplorationRate = 0
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			balancer.Dispatch(context.Background(), 1)
+		}()
+	}
+	wg.Wait()
+	balancer.TickOnce()
+
+	// 4 / 10ms = 400/s and 4 / 40ms = 100/s
+	caps := balancer.GetCapacities()
+	assert.InDelta(t, 400, caps[0], 100)
+	assert.InDelta(t, 100, caps[1], 25)
+}
+
+func TestErrorPolicy(t *testing.T) {
+	seed := []lb.Observation{{Handler: 0, Calls: 10, Errors: 6}}
+	estimate := func(policy lb.ErrorPolicy, estimator func() lb.Estimator) float64 {
+		balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1)...)
+		balancer.Estimator = estimator
+		balancer.ErrorPolicy = policy
+		balancer.SetAllCapacities([]float64{10})
+		balancer.Seed(seed)
+		return balancer.GetCapacities()[0]
+	}
+
+	window := lb.NewWindowAverage(1)
+	assert.Equal(t, 10.0, estimate(lb.ErrorsAsCalls, window))
+	assert.Equal(t, 4.0, estimate(lb.ErrorsIgnored, window))
+	assert.Equal(t, 4.0, estimate(lb.ErrorsAsRejections, window))
+
+	// AIMD backs off on the errors when they count as rejections
+	aimd := func() lb.Estimator { return lb.AIMD{} }
+	ignored := estimate(lb.ErrorsIgnored, aimd)
+	assert.Less(t, ignored, estimate(lb.ErrorsAsCalls, aimd))
+	assert.Less(t, estimate(lb.ErrorsAsRejections, aimd), ignored)
+}
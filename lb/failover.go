@@ -0,0 +1,152 @@
+package lb
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A named group of handlers, usually all living in the same region or
+// datacenter.
+type Cluster[T any, U any] struct {
+	Name     string
+	Handlers []Handler[T, U]
+}
+
+// Configuration for [Failover]. Should not be changed after you call
+// [Failover.Start].
+type FailoverConfig struct {
+	// The primary cluster is considered degraded when its total estimated
+	// capacity, in tasks per second, drops below this.
+	MinCapacity float64
+	// Fraction of traffic moved to the secondary cluster while the primary is
+	// degraded, between 0 and 1.
+	ShiftFraction float64
+	// Fraction of traffic moved back to the primary every update interval
+	// once it has recovered.
+	FailbackStep float64
+	// How often the primary cluster is checked.
+	UpdateInterval time.Duration
+}
+
+// Serves traffic from a primary cluster and shifts part of it to a secondary
+// cluster when the primary doesn't seem to have enough capacity. Each cluster is
+// load balanced by its own [LoadBalancer].
+type Failover[T any, U any] struct {
+	FailoverConfig
+
+	primary   *LoadBalancer[T, U]
+	secondary *LoadBalancer[T, U]
+	names     [2]string
+	shifted   float64 // fraction of traffic currently sent to secondary
+	mut       sync.Mutex
+	done      chan struct{}
+}
+
+func NewFailover[T any, U any](primary, secondary Cluster[T, U]) *Failover[T, U] {
+	return &Failover[T, U]{
+		FailoverConfig: FailoverConfig{
+			MinCapacity:    1,
+			ShiftFraction:  0.5,
+			FailbackStep:   0.1,
+			UpdateInterval: time.Second,
+		},
+		primary:   NewLoadBalancer(primary.Handlers...),
+		secondary: NewLoadBalancer(secondary.Handlers...),
+		names:     [2]string{primary.Name, secondary.Name},
+		shifted:   0,
+		mut:       sync.Mutex{},
+		done:      make(chan struct{}, 2),
+	}
+}
+
+// Returns the load balancer of the primary cluster, e.g. to tune its [Config].
+func (f *Failover[T, U]) Primary() *LoadBalancer[T, U] {
+	return f.primary
+}
+
+// Returns the load balancer of the secondary cluster, e.g. to tune its
+// [Config].
+func (f *Failover[T, U]) Secondary() *LoadBalancer[T, U] {
+	return f.secondary
+}
+
+// Returns the names of the primary and secondary clusters.
+func (f *Failover[T, U]) Names() (string, string) {
+	return f.names[0], f.names[1]
+}
+
+// Returns the fraction of traffic currently being sent to the secondary
+// cluster.
+func (f *Failover[T, U]) Shifted() float64 {
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	return f.shifted
+}
+
+func (f *Failover[T, U]) spin() {
+	ticker := time.NewTicker(f.UpdateInterval)
+	for {
+		select {
+		case <-ticker.C:
+			f.update()
+		case <-f.done:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Checks the primary cluster and moves traffic accordingly. Failing over is
+// immediate, failing back happens over a few update intervals so a barely
+// recovered primary is not flooded at once.
+func (f *Failover[T, U]) update() {
+	f.primary.mut.Lock()
+	primaryCap := f.primary.totalCap
+	f.primary.mut.Unlock()
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	if primaryCap < f.MinCapacity {
+		f.shifted = max(f.shifted, f.ShiftFraction)
+	} else {
+		f.shifted = max(f.shifted-f.FailbackStep, 0)
+	}
+}
+
+// Synchronously runs a single update cycle of both clusters' load balancers
+// and then the failover check, as if one [FailoverConfig.UpdateInterval] had
+// passed. Meant for tests and simulations, like [LoadBalancer.TickOnce].
+func (f *Failover[T, U]) TickOnce() {
+	f.primary.TickOnce()
+	f.secondary.TickOnce()
+	f.update()
+}
+
+// Starts both clusters' load balancers and the failover checks.
+func (f *Failover[T, U]) Start() {
+	f.primary.Start()
+	f.secondary.Start()
+	go f.spin()
+}
+
+// Stops both clusters' load balancers and the failover checks.
+func (f *Failover[T, U]) Destroy() {
+	f.primary.Destroy()
+	f.secondary.Destroy()
+	f.done <- struct{}{}
+}
+
+// Dispatches to the primary cluster, or the secondary one if traffic is
+// currently being shifted.
+func (f *Failover[T, U]) Dispatch(ctx context.Context, param T) (U, error) {
+	f.mut.Lock()
+	shifted := f.shifted
+	f.mut.Unlock()
+
+	if shifted > 0 && rand.Float64() < shifted {
+		return f.secondary.Dispatch(ctx, param)
+	}
+	return f.primary.Dispatch(ctx, param)
+}
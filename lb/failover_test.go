@@ -0,0 +1,57 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func namedHandler(name string) lb.Handler[int, string] {
+	return lb.Handler[int, string]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (string, error) {
+			return name, nil
+		},
+	}
+}
+
+// Tests that traffic moves to the secondary cluster when the primary loses
+// capacity, and gradually comes back when it recovers.
+func TestFailoverShiftsAndFailsBack(t *testing.T) {
+	failover := lb.NewFailover(
+		lb.Cluster[int, string]{
+			Name:     "primary",
+			Handlers: []lb.Handler[int, string]{namedHandler("primary")},
+		},
+		lb.Cluster[int, string]{
+			Name:     "secondary",
+			Handlers: []lb.Handler[int, string]{namedHandler("secondary")},
+		},
+	)
+	failover.MinCapacity = 5
+	failover.ShiftFraction = 1
+	failover.FailbackStep = 0.25
+
+	failover.Primary().SetAllCapacities([]float64{1})
+	failover.TickOnce()
+	assert.Equal(t, 1.0, failover.Shifted())
+	for range 10 {
+		res, err := failover.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "secondary", res)
+	}
+
+	// Fails back one step per update
+	failover.Primary().SetAllCapacities([]float64{10})
+	for _, shifted := range []float64{0.75, 0.5, 0.25, 0, 0} {
+		failover.TickOnce()
+		assert.Equal(t, shifted, failover.Shifted())
+	}
+	for range 10 {
+		res, err := failover.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "primary", res)
+	}
+}
@@ -0,0 +1,43 @@
+package lb
+
+import (
+	"context"
+	"errors"
+)
+
+// Adds a handler to call when none of the handlers can take a call: there are
+// none, they are all out of quota, they rejected it and retries are disabled,
+// or the call was shed and [LoadBalancer.OnShed] isn't set. Fallbacks are tried in the order they were added until one
+// succeeds, e.g. serving from a cache and then returning a canned response.
+// They don't take part in capacity estimation. Should not be called after you
+// start dispatching. Returns the load balancer for chaining.
+func (l *LoadBalancer[T, U]) WithFallback(h Handler[T, U]) *LoadBalancer[T, U] {
+	l.fallbacks = append(l.fallbacks, h.Dispatch)
+	return l
+}
+
+// Whether err means no handler could take the call, rather than a handler
+// failing it.
+func unavailable(err error) bool {
+	return errors.Is(err, ErrNoHandlers) ||
+		errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, ErrShed) ||
+		errors.Is(err, ErrQuotaExhausted) ||
+		errors.Is(err, ErrExceedCap)
+}
+
+// Tries the fallbacks in order. If they all fail, the error joins the original
+// error with theirs.
+func (l *LoadBalancer[T, U]) fallback(ctx context.Context, param T, err error) (U, error) {
+	var res U
+	errs := []error{err}
+	for _, dispatch := range l.fallbacks {
+		var ferr error
+		res, ferr = dispatch(ctx, param)
+		if ferr == nil {
+			return res, nil
+		}
+		errs = append(errs, ferr)
+	}
+	return res, errors.Join(errs...)
+}
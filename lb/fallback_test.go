@@ -0,0 +1,57 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func canned(res int, err error) lb.Handler[int, int] {
+	return lb.Handler[int, int]{
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return res, err
+		},
+	}
+}
+
+func TestFallbackNoHandlers(t *testing.T) {
+	balancer := lb.NewLoadBalancer[int, int]().WithFallback(canned(42, nil))
+
+	res, err := balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 42, res)
+}
+
+func TestFallbackChain(t *testing.T) {
+	out := canned(0, &lb.QuotaExhaustedError{Reset: time.Now().Add(time.Hour)})
+	cacheMiss := errors.New("cache miss")
+	balancer := lb.NewLoadBalancer(out).
+		WithFallback(canned(0, cacheMiss)).
+		WithFallback(canned(7, nil))
+
+	res, err := balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, res)
+}
+
+func TestFallbackAllFail(t *testing.T) {
+	cacheMiss := errors.New("cache miss")
+	balancer := lb.NewLoadBalancer(canned(0, lb.ErrExceedCap)).
+		WithFallback(canned(0, cacheMiss))
+
+	_, err := balancer.Dispatch(lb.NoRetry(context.Background()), 0)
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+	assert.ErrorIs(t, err, cacheMiss)
+}
+
+func TestFallbackNotOnHandlerError(t *testing.T) {
+	broken := errors.New("broken")
+	balancer := lb.NewLoadBalancer(canned(0, broken)).WithFallback(canned(7, nil))
+
+	_, err := balancer.Dispatch(context.Background(), 0)
+	assert.ErrorIs(t, err, broken)
+}
@@ -0,0 +1,70 @@
+package lb
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Dispatches every param through the load balancer on g, calling fn with each
+// result, with as many running at once as the handlers can take: the total
+// learned capacity times the average latency. Until latencies are known that is
+// one second's worth of capacity. Returns once everything is scheduled, call
+// g.Wait to wait for it all to finish. The first error, from a dispatch or fn,
+// is returned by g.Wait, and if ctx comes from [errgroup.WithContext] it also
+// stops scheduling the rest.
+func (l *LoadBalancer[T, U]) Go(ctx context.Context, g *errgroup.Group, params []T, fn func(U) error) {
+	var running atomic.Int64
+	freed := make(chan struct{}, 1)
+
+	for _, param := range params {
+		for running.Load() >= int64(l.parallelism()) {
+			select {
+			case <-freed:
+			case <-ctx.Done():
+				g.Go(ctx.Err)
+				return
+			}
+		}
+
+		running.Add(1)
+		g.Go(func() error {
+			defer func() {
+				running.Add(-1)
+				select {
+				case freed <- struct{}{}:
+				default:
+				}
+			}()
+
+			res, err := l.Dispatch(ctx, param)
+			if err != nil {
+				return err
+			}
+			return fn(res)
+		})
+	}
+}
+
+// Returns how many dispatches the handlers can take at once, by Little's law.
+func (l *LoadBalancer[T, U]) parallelism() int {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	// Average latency weighted by capacity, since that is how calls are
+	// spread
+	var latency, weight float64
+	for i, c := range l.caps {
+		if lat := l.ewmaLatency[i].Load(); lat > 0 {
+			latency += c * float64(lat)
+			weight += c
+		}
+	}
+	seconds := 1.0
+	if weight > 0 {
+		seconds = latency / weight / 1e9
+	}
+	return max(int(math.Ceil(l.totalCap*seconds)), 1)
+}
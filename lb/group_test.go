@@ -0,0 +1,58 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestGoBoundsParallelism(t *testing.T) {
+	var running, peak atomic.Int32
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return param, nil
+		},
+	})
+	assert.NoError(t, balancer.SetAllCapacities([]float64{2}))
+
+	var sum atomic.Int64
+	g, ctx := errgroup.WithContext(context.Background())
+	balancer.Go(ctx, g, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, func(res int) error {
+		sum.Add(int64(res))
+		return nil
+	})
+	assert.NoError(t, g.Wait())
+	assert.Equal(t, int64(55), sum.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestGoStopsOnError(t *testing.T) {
+	balancer := newEchoBalancer()
+	assert.NoError(t, balancer.SetAllCapacities([]float64{1}))
+
+	broken := errors.New("broken")
+	var calls atomic.Int32
+	g, ctx := errgroup.WithContext(context.Background())
+	balancer.Go(ctx, g, []int{1, 2, 3, 4, 5}, func(res int) error {
+		calls.Add(1)
+		return broken
+	})
+	assert.ErrorIs(t, g.Wait(), broken)
+	assert.Less(t, calls.Load(), int32(5))
+}
@@ -0,0 +1,69 @@
+package lb
+
+import (
+	"context"
+	"time"
+)
+
+type HandlerFuncE[T any] func(context.Context, T) error
+
+// A handler that doesn't return anything except an error, for fire and forget
+// downstreams. Use it with [NewLoadBalancerE].
+type HandlerE[T any] struct {
+	// Optional name, used to identify this handler in dumps and logs
+	Name string
+	// Estimated capacity of this handler, units of tasks per second
+	EstCap float64
+	// Dispatch function called when this handler is chosen
+	Dispatch HandlerFuncE[T]
+	// Anything you want to attach to this handler, e.g. the client used to
+	// reach it. Handlers can get it back from [DispatchInfoFromContext].
+	Data any
+	// Hard limit on the rate this handler is called at, in tasks per second.
+	// See [Handler.MaxRate]. 0 means no limit.
+	MaxRate float64
+	// Relative weight of this handler as known from elsewhere, see
+	// [Handler.WeightHint]. 0 means no hint.
+	WeightHint float64
+	// Optional multiplier applied on top of the learned capacity depending
+	// on the time, see [Handler.CapacitySchedule].
+	CapacitySchedule func(time.Time) float64
+	// Settings that differ for this handler from the rest of [Config].
+	Overrides HandlerOverrides
+}
+
+// Converts to a regular [Handler] returning an empty struct.
+func (h HandlerE[T]) Handler() Handler[T, struct{}] {
+	return Handler[T, struct{}]{
+		Name:             h.Name,
+		EstCap:           h.EstCap,
+		Dispatch:         h.Dispatch.HandlerFunc(),
+		Data:             h.Data,
+		MaxRate:          h.MaxRate,
+		WeightHint:       h.WeightHint,
+		CapacitySchedule: h.CapacitySchedule,
+		Overrides:        h.Overrides,
+	}
+}
+
+// Converts to a regular [HandlerFunc] returning an empty struct.
+func (f HandlerFuncE[T]) HandlerFunc() HandlerFunc[T, struct{}] {
+	if f == nil {
+		return nil
+	}
+	return func(ctx context.Context, param T) (struct{}, error) {
+		return struct{}{}, f(ctx, param)
+	}
+}
+
+// Like [NewLoadBalancer], but for handlers that only return an error. The
+// results of [LoadBalancer.Dispatch] can simply be ignored, e.g.
+//
+//	_, err := l.Dispatch(ctx, param)
+func NewLoadBalancerE[T any](handlers ...HandlerE[T]) *LoadBalancer[T, struct{}] {
+	converted := make([]Handler[T, struct{}], len(handlers))
+	for i, h := range handlers {
+		converted[i] = h.Handler()
+	}
+	return NewLoadBalancer(converted...)
+}
@@ -0,0 +1,55 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBalancerE(t *testing.T) {
+	errBad := errors.New("bad param")
+	var seen []int
+	balancer := lb.NewLoadBalancerE(lb.HandlerE[int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) error {
+			if param < 0 {
+				return errBad
+			}
+			seen = append(seen, param)
+			return nil
+		},
+	})
+
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+	_, err = balancer.Dispatch(context.Background(), -1)
+	assert.ErrorIs(t, err, errBad)
+	assert.Equal(t, []int{1}, seen)
+}
+
+// Tests that the settings of a HandlerE carry over to the Handler.
+func TestHandlerEFields(t *testing.T) {
+	schedule := lb.DailyMultiplier(9*time.Hour, 17*time.Hour, 0.5)
+	handler := lb.HandlerE[int]{
+		Name:             "a",
+		EstCap:           10,
+		Data:             "client",
+		MaxRate:          20,
+		WeightHint:       2,
+		CapacitySchedule: schedule,
+		Overrides:        lb.HandlerOverrides{SmoothingFactor: 0.9, MaxBackoff: time.Minute},
+	}.Handler()
+
+	assert.Equal(t, "a", handler.Name)
+	assert.Equal(t, 10.0, handler.EstCap)
+	assert.Equal(t, "client", handler.Data)
+	assert.Equal(t, 20.0, handler.MaxRate)
+	assert.Equal(t, 2.0, handler.WeightHint)
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, schedule(noon), handler.CapacitySchedule(noon))
+	assert.Equal(t, lb.HandlerOverrides{SmoothingFactor: 0.9, MaxBackoff: time.Minute}, handler.Overrides)
+}
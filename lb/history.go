@@ -0,0 +1,89 @@
+package lb
+
+import (
+	"slices"
+	"time"
+)
+
+// The weights and capacities of all handlers at some point in time.
+type HistoryEntry struct {
+	Time    time.Time
+	Weights []int
+	Caps    []float64
+}
+
+// Ring buffer of the last few entries, e.g. of the history.
+type ring[E any] struct {
+	entries []E
+	next    int  // where the next entry goes
+	full    bool // whether entries has wrapped around at least once
+}
+
+func (h *ring[E]) add(size int, entry E) {
+	if size <= 0 {
+		h.entries = nil
+		h.next = 0
+		h.full = false
+		return
+	}
+	if len(h.entries) != size {
+		// Size changed, keep the most recent entries that still fit.
+		old := h.list()
+		h.entries = make([]E, size)
+		h.next = 0
+		h.full = false
+		for _, e := range old[max(len(old)-size, 0):] {
+			h.add(size, e)
+		}
+	}
+
+	h.entries[h.next] = entry
+	h.next++
+	if h.next == len(h.entries) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// Returns the entries from oldest to newest.
+func (h *ring[E]) list() []E {
+	if !h.full {
+		return slices.Clone(h.entries[:h.next])
+	}
+	return append(slices.Clone(h.entries[h.next:]), h.entries[:h.next]...)
+}
+
+// Takes a snapshot of the current weights and capacities. Needs the lock.
+func (l *LoadBalancer[T, U]) snapshot(t time.Time) HistoryEntry {
+	return HistoryEntry{
+		Time:    t,
+		Weights: slices.Clone(l.WeightedRoundRobin.GetWeights()),
+		Caps:    slices.Clone(l.caps),
+	}
+}
+
+// Publishes the current weights and capacities for [LoadBalancer.Current].
+// Needs the lock.
+func (l *LoadBalancer[T, U]) publish(t time.Time) {
+	entry := l.snapshot(t)
+	l.published.Store(&entry)
+}
+
+// Returns the weights and capacities as of their last update, taken together
+// so they always correspond, unlike separate calls to [LoadBalancer.GetWeights]
+// and [LoadBalancer.GetCapacities] that an update may come between. Doesn't
+// wait for the lock, so dashboards can poll it as often as they like.
+func (l *LoadBalancer[T, U]) Current() HistoryEntry {
+	entry := *l.published.Load()
+	entry.Weights = slices.Clone(entry.Weights)
+	entry.Caps = slices.Clone(entry.Caps)
+	return entry
+}
+
+// Returns the weights and capacities at the end of each of the last
+// [Config.HistorySize] update intervals, from oldest to newest.
+func (l *LoadBalancer[T, U]) History() []HistoryEntry {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.history.list()
+}
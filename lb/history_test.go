@@ -0,0 +1,75 @@
+package lb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistoryKeepsLastEntries(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.UpdateInterval = 10 * time.Millisecond
+	balancer.HistorySize = 3
+
+	assert.Empty(t, balancer.History())
+
+	balancer.Start()
+	time.Sleep(100 * time.Millisecond)
+	balancer.Destroy()
+
+	history := balancer.History()
+	assert.Len(t, history, 3)
+	for i, entry := range history {
+		assert.Len(t, entry.Weights, 2)
+		assert.Len(t, entry.Caps, 2)
+		if i > 0 {
+			assert.True(t, entry.Time.After(history[i-1].Time))
+		}
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.UpdateInterval = 10 * time.Millisecond
+
+	balancer.Start()
+	time.Sleep(50 * time.Millisecond)
+	balancer.Destroy()
+
+	assert.Empty(t, balancer.History())
+}
+
+// Tests that the weights and capacities from Current always go together, even
+// while they are being updated.
+func TestCurrent(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.SetAllCapacities([]float64{50, 50})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			if i%2 == 0 {
+				balancer.SetAllCapacities([]float64{10, 90})
+			} else {
+				balancer.SetAllCapacities([]float64{90, 10})
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		current := balancer.Current()
+		assert.Equal(t, []int{int(current.Caps[0]), int(current.Caps[1])}, current.Weights)
+	}
+}
@@ -0,0 +1,102 @@
+package lb
+
+import "time"
+
+// Configuration for [NewHoltWinters].
+type HoltWintersConfig struct {
+	// Length of the seasonal cycle, e.g. 24 hours for backends that slow
+	// down during their own daily peak. Rounded to a whole number of update
+	// intervals, so keep it to at most a few thousand intervals.
+	Season time.Duration
+	// Smoothing factors of the level, trend and seasonal components, between
+	// 0 and 1. Higher values adapt faster.
+	Alpha float64
+	Beta  float64
+	Gamma float64
+	// How many update intervals ahead to forecast. The weights follow the
+	// forecast, so this is how early they move ahead of a predicted dip.
+	Lookahead int
+}
+
+// Returns a [Config.Estimator] that forecasts capacity with additive
+// Holt-Winters (triple exponential smoothing) over the estimates of [AIMD].
+// Handlers whose capacity follows a daily or weekly pattern get their weights
+// adjusted ahead of time instead of lagging behind. Until a full season has
+// been observed the [AIMD] estimate is used as is. A capacity set from
+// outside, e.g. by [LoadBalancer.SetAllCapacities], moves the level of the
+// forecast along with it.
+func NewHoltWinters(cfg HoltWintersConfig) func() Estimator {
+	return func() Estimator {
+		return &holtWinters{cfg: cfg}
+	}
+}
+
+type holtWinters struct {
+	cfg HoltWintersConfig
+
+	base    AIMD
+	baseCap float64   // estimate of the base estimator, which keeps its own state
+	season  []float64 // seasonal component, or the first season's values while warming up
+	level   float64
+	trend   float64
+	t       int     // number of samples seen
+	last    float64 // forecast last returned
+}
+
+func (h *holtWinters) Estimate(c *Config, capacity float64, s Sample) float64 {
+	if h.t > 0 && capacity != h.last {
+		// Changed since the last forecast, start from where it was put
+		delta := capacity - h.last
+		h.baseCap = max(h.baseCap+delta, 0.1)
+		if h.t >= len(h.season) {
+			h.level += delta
+		} else {
+			// Still warming up, the level is yet to be taken from these
+			for k := range h.t {
+				h.season[k] += delta
+			}
+		}
+	}
+	h.last = h.forecast(c, capacity, s)
+	return h.last
+}
+
+func (h *holtWinters) forecast(c *Config, capacity float64, s Sample) float64 {
+	if h.t == 0 {
+		h.baseCap = capacity
+		m := 1
+		if c.UpdateInterval > 0 {
+			m = max(int(h.cfg.Season/c.UpdateInterval), 1)
+		}
+		h.season = make([]float64, m)
+	}
+	h.baseCap = max(h.base.Estimate(c, h.baseCap, s), 0.1)
+	x := h.baseCap
+
+	m := len(h.season)
+	i := h.t % m
+	h.t++
+
+	if h.t <= m {
+		// Still warming up, just collect the first season.
+		h.season[i] = x
+		if h.t < m {
+			return x
+		}
+		for _, v := range h.season {
+			h.level += v
+		}
+		h.level /= float64(m)
+		for k := range h.season {
+			h.season[k] -= h.level
+		}
+	} else {
+		prevLevel := h.level
+		h.level = h.cfg.Alpha*(x-h.season[i]) + (1-h.cfg.Alpha)*(h.level+h.trend)
+		h.trend = h.cfg.Beta*(h.level-prevLevel) + (1-h.cfg.Beta)*h.trend
+		h.season[i] = h.cfg.Gamma*(x-h.level) + (1-h.cfg.Gamma)*h.season[i]
+	}
+
+	ahead := max(h.cfg.Lookahead, 1)
+	return h.level + float64(ahead)*h.trend + h.season[(i+ahead)%m]
+}
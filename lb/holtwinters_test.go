@@ -0,0 +1,84 @@
+package lb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that a handler with a regular dip gets its capacity lowered right
+// before the dip, while the reactive estimate is still high.
+func TestHoltWintersAnticipatesDips(t *testing.T) {
+	pattern := []int{10, 10, 10, 2}
+	var observations []lb.Observation
+	for range 30 {
+		for _, calls := range pattern {
+			observations = append(observations,
+				lb.Observation{Handler: 0, Calls: calls},
+				lb.Observation{Handler: 1, Calls: 5},
+			)
+		}
+	}
+	// stop right before the dip
+	observations = observations[:len(observations)-2]
+
+	newBalancer := func() *lb.LoadBalancer[int, int] {
+		balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+		balancer.SmoothingFactor = 1
+		balancer.AIMDIncrease = 0
+		return balancer
+	}
+
+	reactive := newBalancer()
+	reactive.Seed(observations)
+	assert.InDelta(t, 10, reactive.GetCapacities()[0], 0.1)
+
+	forecasting := newBalancer()
+	forecasting.Estimator = lb.NewHoltWinters(lb.HoltWintersConfig{
+		Season:    4 * time.Second,
+		Alpha:     0.5,
+		Beta:      0.1,
+		Gamma:     0.5,
+		Lookahead: 1,
+	})
+	forecasting.Seed(observations)
+	assert.InDelta(t, 2, forecasting.GetCapacities()[0], 0.5)
+	assert.InDelta(t, 5, forecasting.GetCapacities()[1], 0.5)
+}
+
+// Tests that the forecast starts from a capacity set from outside instead of
+// overwriting it with its own state.
+func TestHoltWintersExternalCapacity(t *testing.T) {
+	newBalancer := func() *lb.LoadBalancer[int, int] {
+		balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1)...)
+		balancer.AIMDIncrease = 0
+		balancer.Estimator = lb.NewHoltWinters(lb.HoltWintersConfig{
+			Season: 2 * time.Second,
+			Alpha:  0.5,
+			Beta:   0.1,
+			Gamma:  0.5,
+		})
+		return balancer
+	}
+	steady := func(n int) []lb.Observation {
+		observations := make([]lb.Observation, n)
+		for i := range observations {
+			observations[i] = lb.Observation{Handler: 0, Calls: 10}
+		}
+		return observations
+	}
+
+	// Set during the first season and after
+	for _, n := range []int{1, 8} {
+		set, unset := newBalancer(), newBalancer()
+		set.Seed(steady(n))
+		unset.Seed(steady(n))
+		set.SetAllCapacities([]float64{40})
+		set.Seed(steady(1))
+		unset.Seed(steady(1))
+		assert.Greater(t, set.GetCapacities()[0], unset.GetCapacities()[0]+10)
+	}
+}
@@ -0,0 +1,38 @@
+package lb
+
+import "context"
+
+// Describes the attempt a handler is being called for. Handlers can get it
+// from their context with [DispatchInfoFromContext].
+type DispatchInfo struct {
+	// Index of the handler being called
+	Index int
+	// Name of the handler being called, see [Handler.Name]
+	Name string
+	// Number of this attempt on this handler, starting from 0
+	Attempt int
+	// Data attached to the handler being called, see [Handler.Data]
+	Data any
+	// Whether the handler was chosen by exploration rather than by its
+	// weight, see [Config.ExplorationRate]
+	Explore bool
+}
+
+type dispatchInfoKey struct{}
+
+// Returns the [DispatchInfo] of the attempt the context was created for.
+func DispatchInfoFromContext(ctx context.Context) (DispatchInfo, bool) {
+	info, ok := ctx.Value(dispatchInfoKey{}).(DispatchInfo)
+	return info, ok
+}
+
+func withDispatchInfo(ctx context.Context, info DispatchInfo) context.Context {
+	return context.WithValue(ctx, dispatchInfoKey{}, info)
+}
+
+// Returns the data attached to handler i, see [Handler.Data].
+func (l *LoadBalancer[T, U]) HandlerData(i int) any {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.data[i]
+}
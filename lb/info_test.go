@@ -0,0 +1,41 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	prefix string
+}
+
+func TestDispatchInfo(t *testing.T) {
+	dispatch := func(ctx context.Context, param string) (string, error) {
+		info, ok := lb.DispatchInfoFromContext(ctx)
+		if !ok {
+			return "", nil
+		}
+		if info.Attempt == 0 {
+			return "", lb.ErrExceedCap
+		}
+		return info.Data.(*fakeClient).prefix + param, nil
+	}
+	balancer := lb.NewLoadBalancer(lb.Handler[string, string]{
+		Name:     "only",
+		EstCap:   1,
+		Data:     &fakeClient{prefix: "hello "},
+		Dispatch: dispatch,
+	})
+	balancer.BackoffUnit = 0
+
+	res, err := balancer.Dispatch(context.Background(), "world")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", res)
+	assert.Equal(t, "hello ", balancer.HandlerData(0).(*fakeClient).prefix)
+
+	_, ok := lb.DispatchInfoFromContext(context.Background())
+	assert.False(t, ok)
+}
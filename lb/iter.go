@@ -0,0 +1,56 @@
+package lb
+
+import "iter"
+
+// Identifies a handler, see [LoadBalancer.All].
+type HandlerInfo struct {
+	Index int
+	Name  string
+	// See [Handler.Data]
+	Data any
+}
+
+// Iterates over the handlers and their current stats, without allocating.
+// Each handler's stats are taken right before it is yielded, so unlike
+// [LoadBalancer.GetStats] they are not all from the same instant. The load
+// balancer is not locked while the loop body runs.
+func (l *LoadBalancer[T, U]) All() iter.Seq2[HandlerInfo, HandlerStats] {
+	return func(yield func(HandlerInfo, HandlerStats) bool) {
+		for i := 0; ; i++ {
+			l.mut.Lock()
+			if i >= len(l.caps) {
+				l.mut.Unlock()
+				return
+			}
+			info := HandlerInfo{Index: i, Name: l.names[i], Data: l.data[i]}
+			stats := l.handlerStats(i)
+			l.mut.Unlock()
+			if !yield(info, stats) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over the stats of every handler, like [LoadBalancer.All].
+func (l *LoadBalancer[T, U]) AllStats() iter.Seq[HandlerStats] {
+	return func(yield func(HandlerStats) bool) {
+		for _, stats := range l.All() {
+			if !yield(stats) {
+				return
+			}
+		}
+	}
+}
+
+// Iterates over [LoadBalancer.History] from oldest to newest. The entries are
+// those kept when the loop starts.
+func (l *LoadBalancer[T, U]) AllHistory() iter.Seq[HistoryEntry] {
+	return func(yield func(HistoryEntry) bool) {
+		for _, entry := range l.History() {
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package lb_test
+
+import (
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAll(t *testing.T) {
+	handlers := newNamedHandlers("a", "b", "c")
+	handlers[1].Data = "data"
+	balancer := lb.NewLoadBalancer(handlers...)
+	assert.NoError(t, balancer.SetAllCapacities([]float64{10, 30, 60}))
+
+	var names []string
+	for info, stats := range balancer.All() {
+		assert.Equal(t, info.Index, stats.Index)
+		assert.Equal(t, info.Name, stats.Name)
+		// Must not deadlock
+		balancer.GetStats()
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names)
+
+	for info := range balancer.All() {
+		assert.Equal(t, "a", info.Name)
+		break
+	}
+
+	var caps []float64
+	for stats := range balancer.AllStats() {
+		caps = append(caps, stats.Capacity)
+	}
+	assert.Equal(t, []float64{10, 30, 60}, caps)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		for range balancer.All() {
+		}
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestAllHistory(t *testing.T) {
+	balancer := lb.NewLoadBalancer(newNamedHandlers("a", "b")...)
+	balancer.HistorySize = 2
+	for range 3 {
+		balancer.TickOnce()
+	}
+
+	var entries []lb.HistoryEntry
+	for entry := range balancer.AllHistory() {
+		entries = append(entries, entry)
+	}
+	assert.Equal(t, balancer.History(), entries)
+}
@@ -0,0 +1,61 @@
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type balancerState struct {
+	Config        Config         `json:"config"`
+	TotalCapacity float64        `json:"total_capacity"`
+	Handlers      []HandlerStats `json:"handlers"`
+	Removed       []HandlerStats `json:"removed,omitempty"`
+	Queue         QueueStats     `json:"queue"`
+	Strategy      any            `json:"strategy,omitempty"`
+}
+
+// Takes a consistent snapshot of everything worth dumping.
+func (l *LoadBalancer[T, U]) state() balancerState {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	s := balancerState{
+		Config:        l.Config,
+		TotalCapacity: l.totalCap,
+		Handlers:      make([]HandlerStats, len(l.caps)),
+		Queue:         l.admission.stats(),
+	}
+	if d, ok := l.strategy.(StrategyDebugger); ok {
+		s.Strategy = d.DebugState()
+	}
+	for i := range l.caps {
+		s.Handlers[i] = l.handlerStats(i)
+	}
+	for _, t := range l.tombstones {
+		s.Removed = append(s.Removed, t.stats)
+	}
+	return s
+}
+
+// Dumps the config and the current state of every handler. Meant for debug
+// endpoints and bug reports, the format may change between versions.
+func (l *LoadBalancer[T, U]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.state())
+}
+
+// Returns a human readable summary of the current state of every handler.
+func (l *LoadBalancer[T, U]) String() string {
+	s := l.state()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "lb with %d handlers, total capacity %.2f/s", len(s.Handlers), s.TotalCapacity)
+	for _, h := range s.Handlers {
+		fmt.Fprintf(&b, "\n  %d", h.Index)
+		if h.Name != "" {
+			fmt.Fprintf(&b, " %q", h.Name)
+		}
+		fmt.Fprintf(&b, ": weight %d, capacity %.2f/s", h.Weight, h.Capacity)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package lb_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 1},
+		lb.Handler[int, int]{Name: "b", EstCap: 3},
+	)
+
+	data, err := json.Marshal(balancer)
+	assert.NoError(t, err)
+
+	var dump struct {
+		Config struct {
+			WeightScale int
+		} `json:"config"`
+		TotalCapacity float64 `json:"total_capacity"`
+		Handlers      []struct {
+			Index    int     `json:"index"`
+			Name     string  `json:"name"`
+			Weight   int     `json:"weight"`
+			Capacity float64 `json:"capacity"`
+		} `json:"handlers"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &dump))
+	assert.Equal(t, 100, dump.Config.WeightScale)
+	assert.Equal(t, 4.0, dump.TotalCapacity)
+	assert.Len(t, dump.Handlers, 2)
+	assert.Equal(t, "b", dump.Handlers[1].Name)
+	assert.Equal(t, 75, dump.Handlers[1].Weight)
+	assert.Equal(t, 3.0, dump.Handlers[1].Capacity)
+}
+
+func TestString(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 1},
+		lb.Handler[int, int]{EstCap: 3},
+	)
+
+	expected := "lb with 2 handlers, total capacity 4.00/s\n" +
+		"  0 \"a\": weight 25, capacity 1.00/s\n" +
+		"  1: weight 75, capacity 3.00/s"
+	assert.Equal(t, expected, balancer.String())
+}
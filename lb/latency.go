@@ -0,0 +1,43 @@
+package lb
+
+import (
+	"math"
+	"time"
+)
+
+// Scales the shares of handlers down by how much slower they are than the
+// fastest one, see [Config.LatencyWeight]. Needs the lock.
+func (l *LoadBalancer[T, U]) weighLatency(shares []float64) {
+	if l.LatencyWeight <= 0 {
+		return
+	}
+
+	var fastest int64
+	for i, share := range shares {
+		latency := l.ewmaLatency[i].Load()
+		if share > 0 && latency > 0 && (fastest == 0 || latency < fastest) {
+			fastest = latency
+		}
+	}
+	if fastest == 0 {
+		return
+	}
+	for i := range shares {
+		if latency := l.ewmaLatency[i].Load(); latency > 0 {
+			shares[i] *= math.Pow(float64(fastest)/float64(latency), l.LatencyWeight)
+		}
+	}
+}
+
+// Returns the moving average latency of each handler, 0 for those yet to
+// complete a call. See [HandlerStats.Latency] and [Config.LatencyWeight].
+func (l *LoadBalancer[T, U]) GetLatencies() []time.Duration {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	latencies := make([]time.Duration, len(l.ewmaLatency))
+	for i := range latencies {
+		latencies[i] = time.Duration(l.ewmaLatency[i].Load())
+	}
+	return latencies
+}
@@ -0,0 +1,31 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLatencyWeight(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10},
+		lb.Handler[int, int]{EstCap: 10},
+		lb.Handler[int, int]{EstCap: 10},
+	)
+	balancer.RecordResult(context.Background(), 0, nil, 10*time.Millisecond)
+	balancer.RecordResult(context.Background(), 1, nil, 40*time.Millisecond)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 40 * time.Millisecond, 0}, balancer.GetLatencies())
+
+	// Off by default
+	balancer.SetAllCapacities([]float64{10, 10, 10})
+	assert.Equal(t, []int{34, 33, 33}, balancer.GetWeights())
+
+	// The slow handler gets a quarter of the traffic of the fast one, the
+	// one without a latency yet is left alone
+	balancer.LatencyWeight = 1
+	balancer.SetAllCapacities([]float64{10, 10, 10})
+	assert.Equal(t, []int{45, 11, 44}, balancer.GetWeights())
+}
@@ -2,13 +2,19 @@ package lb
 
 import (
 	"context"
+	"encoding/csv"
 	"errors"
+	"fmt"
+	"io"
 	"math/rand"
+	"slices"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/podocarp/dynlb-go/internal/rr"
+	"golang.org/x/time/rate"
 )
 
 type HandlerFunc[T any, U any] func(context.Context, T) (U, error)
@@ -17,10 +23,29 @@ type HandlerFunc[T any, U any] func(context.Context, T) (U, error)
 // is called, it will choose an appropriate handler and call the the supplied
 // Dispatch function.
 type Handler[T any, U any] struct {
+	// Optional name, used to identify this handler in dumps and logs
+	Name string
 	// Estimated capacity of this handler, units of tasks per second
 	EstCap float64
 	// Dispatch function called when this handler is chosen
 	Dispatch HandlerFunc[T, U]
+	// Anything you want to attach to this handler, e.g. the client used to
+	// reach it. Handlers can get it back from [DispatchInfoFromContext].
+	Data any
+	// Hard limit on the rate this handler is called at, in tasks per second.
+	// Calls are paced to never exceed it, even while probing, and the
+	// estimated capacity never goes above it. 0 means no limit.
+	MaxRate float64
+	// Relative weight of this handler as known from elsewhere, e.g. the
+	// instance size from service discovery. Blended with the learned
+	// capacities according to [Config.HintTrust]. 0 means no hint.
+	WeightHint float64
+	// Optional multiplier applied on top of the learned capacity depending
+	// on the time, e.g. to encode the backend's known busy hours before the
+	// estimate has to react to them. See [DailyMultiplier].
+	CapacitySchedule func(time.Time) float64
+	// Settings that differ for this handler from the rest of [Config].
+	Overrides HandlerOverrides
 }
 
 // Configuration for the load balancer. Should not be changed after you call
@@ -30,71 +55,352 @@ type Config struct {
 	BackoffUnit        time.Duration
 	UpdateInterval     time.Duration
 	SmoothingFactor    float64
+	// Weight of the latest call in each handler's moving average latency,
+	// between 0 and 1. See [HandlerStats.Latency].
+	LatencySmoothingFactor float64
+	// Fraction of UpdateInterval, between 0 and 1, by which the first tick
+	// after [LoadBalancer.Start] is delayed at random, so many instances
+	// started together don't all shift traffic at the same instant and hit
+	// the backends they share with synchronized waves of load. 0 ticks in
+	// step with Start.
+	TickJitter float64
 
-	// Exploration rate for ε-greedy algorithm
+	// Sum of the weights handed to the round robin scheduler. Higher values
+	// give finer grained weights.
+	WeightScale int
+	// Upper bound on the number of round robin rounds (the largest weight).
+	// Weights above this are scaled down before scheduling so a single
+	// dominant handler cannot monopolize long stretches of the schedule. 0
+	// means unbounded.
+	MaxRounds int
+	// If set, maps capacities to round robin weights instead of making the
+	// weights proportional to the capacities. It gets the capacity of every
+	// handler, after [Config.HintTrust] is applied and with 0 for handlers
+	// out of quota, and their stats, which still hold the old weights.
+	// Results of the wrong length are ignored and negative weights count as
+	// 0.
+	WeightFunc func(caps []float64, stats []HandlerStats) []int `json:"-"`
+	// How much the weights follow [Handler.WeightHint] rather than the
+	// learned capacities, between 0 and 1. Handlers without a hint are not
+	// affected.
+	HintTrust float64
+	// How much slower handlers are weighted down for their latency, so a
+	// handler that is slow without rejecting calls gets less traffic. Each
+	// handler's weight is scaled by the latency of the fastest handler over
+	// its own, both as in [HandlerStats.Latency], to this power. 0 goes by
+	// capacity alone, 1 cuts the weight of a handler twice as slow in half.
+	// Handlers yet to complete a call are not affected.
+	LatencyWeight float64
+
+	// Exploration rate for ε-greedy algorithm. Exploratory calls favor
+	// handlers that haven't completed a call for the longest time, since
+	// their estimates are the most out of date.
 	ExplorationRate float64
+	// Don't count errors from exploratory calls against the handler, so
+	// probing a struggling handler doesn't add to its error penalty. They
+	// don't count as calls either, so they can't pass for goodput. See
+	// [HandlerStats.ExplorationErrors].
+	ExcludeExplorationErrors bool
+	// When a handler rejects a call, send the call to another handler that
+	// isn't backing off instead of waiting, if there is one. Those
+	// deflections are counted in [HandlerStats.Deflections].
+	Deflect bool
+	// If set, handlers added with [LoadBalancer.AddHandler] or
+	// [LoadBalancer.SetHandlers] only get exploratory calls until they
+	// complete this many with at least [Config.QuarantineSuccessRate] of them
+	// succeeding, instead of real traffic right away. They then start from
+	// their [Handler.EstCap] like any other new handler. While every handler
+	// left is quarantined they take the traffic regardless. Needs
+	// [Config.ExplorationRate], or they never leave quarantine. See
+	// [HandlerStats.Quarantined].
+	QuarantineCalls int
+	// Share of the exploratory calls a quarantined handler must succeed at to
+	// leave quarantine, between 0 and 1. Otherwise it starts over.
+	QuarantineSuccessRate float64
+	// Minimum time between rebalancing the weights when handlers come or go,
+	// so a burst of changes, e.g. from a flapping service discovery, is
+	// rebalanced once instead of once per change. Changes in between keep
+	// the weights handlers had, new handlers getting none until the window
+	// ends. 0 rebalances on every change.
+	RebalanceDebounce time.Duration
+	// If set, each attempt gets a context whose deadline is the caller's
+	// minus the backoff before the next attempt and this margin, so a slow
+	// handler can't use up the time needed to fail over to another one. An
+	// attempt that runs out of time counts as failed and the call is sent to
+	// another handler. 0 passes the caller's deadline through as is.
+	DeadlineMargin time.Duration
+
+	// Maximum number of dispatches running at once across all handlers,
+	// including those backing off. Further dispatches wait for one to finish.
+	// Dispatches given a cost with [WithCost] count that many times. 0 means
+	// no limit.
+	MaxInFlight int
+	// Instead of waiting when [Config.MaxInFlight] dispatches are running,
+	// fail right away with [ErrShed].
+	ShedWhenFull bool
+	// Maximum number of dispatches waiting under [Config.MaxInFlight]. When
+	// the queue is full one of them, or the one arriving, is turned away with
+	// [ErrShed] as chosen by [Config.ShedStrategy]. 0 means no limit.
+	MaxQueue int
+	// Who to turn away when the queue is full, see [Config.MaxQueue].
+	ShedStrategy ShedStrategy
+	// Fail attempts right away with [ErrDeadlineUnmeetable] when the time
+	// left before the caller's deadline is less than the chosen handler's
+	// average latency, instead of spending its capacity on a call that will
+	// most likely time out.
+	ShedUnmeetable bool
+	// If set, keeps the queue under [Config.MaxInFlight] short under
+	// sustained overload: once dispatches have waited longer than this for a
+	// whole [Config.CoDelInterval], waiting dispatches are dropped with
+	// [ErrShed], more and more often, until waits are back under it. 0
+	// disables it.
+	CoDelTarget time.Duration
+	// How long waits may stay above [Config.CoDelTarget] before dropping
+	// starts, roughly the time a dispatch normally takes.
+	CoDelInterval time.Duration
 	// Additive increase amount for AIMD
 	AIMDIncrease float64
 	// Multiplicative decrease factor for AIMD
 	AIMDDecreaseFactor float64
+	// If set, calls to each handler are paced to this fraction of its
+	// estimated capacity, between 0 and 1, leaving headroom for other
+	// clients of the same handlers instead of running at the edge and
+	// getting rejected all the time. Observed rates are scaled up by the same
+	// fraction so the estimates don't shrink to the paced rate. Takes effect
+	// the next time the weights are updated. 0 disables pacing.
+	TargetUtilization float64
+
+	// Estimate capacity from goodput, the calls that didn't fail, instead of
+	// all calls. Otherwise a handler that quickly fails everything looks
+	// like it has a lot of capacity. Same as [ErrorsIgnored], and takes
+	// precedence over [Config.ErrorPolicy].
+	WeightByGoodput bool
+	// How the built in estimators count calls that failed with an error
+	// other than [ErrExceedCap]. Defaults to [ErrorsAsCalls].
+	ErrorPolicy ErrorPolicy
+	// If set, handlers returning errors have their weight cut by the share
+	// of calls that failed, and the cut then halves every this long. So a
+	// handler recovers from a blip at a predictable pace even if it gets
+	// little traffic. 0 disables the penalty.
+	ErrorPenaltyHalfLife time.Duration
+
+	// How long responses are cached for, see [LoadBalancer.CacheKey].
+	CacheTTL time.Duration
+	// Maximum number of cached responses, the oldest are evicted first.
+	CacheSize int
+	// If set, keys whose handler failed with a hard error, one that isn't
+	// about capacity, quota or the caller giving up, fail right away with
+	// [ErrCachedFailure] for this long instead of being dispatched again.
+	// Shares [Config.CacheSize]. 0 disables it.
+	NegativeCacheTTL time.Duration
+	// How long a request key sticks to the handler that last succeeded for
+	// it, see [LoadBalancer.AffinityKey].
+	AffinityTTL time.Duration
+	// Maximum number of request keys remembered for affinity, the oldest
+	// are forgotten first.
+	AffinitySize int
+
+	// Creates the capacity estimator of each handler. Defaults to [AIMD].
+	Estimator func() Estimator `json:"-"`
+	// If set, every input and output of the estimators is written here as
+	// CSV, for offline analysis. See [ResearchColumns] for the schema.
+	ResearchLog io.Writer `json:"-"`
+
+	// How long a handler is taken out of rotation after returning
+	// [ErrQuotaExhausted] without a reset time.
+	QuotaResetAfter time.Duration
+	// If set, the clock quotas, cool downs, quarantines and
+	// [Handler.CapacitySchedule] go by, e.g. a fake clock in tests. Latencies
+	// and the interval between ticks are still measured on the real clock.
+	// Defaults to [time.Now].
+	Now func() time.Time `json:"-"`
+
+	// If set, every attempt to call a handler is recorded here. See [Replay].
+	Recorder *Recorder `json:"-"`
+	// If set, only attempts this returns true for are recorded, to bound the
+	// cost of recording at high rates. See [SampleOneIn]. Replaying a
+	// sampled recording underestimates the traffic that was sampled out.
+	RecordSampler func(Record) bool `json:"-"`
+	// Number of past weights and capacities to keep, see
+	// [LoadBalancer.History]. 0 keeps none.
+	HistorySize int
+	// Number of changes made at runtime to keep, see
+	// [LoadBalancer.AuditLog]. 0 keeps none.
+	AuditLogSize int
+	// Number of removed handlers whose final stats are kept, see
+	// [LoadBalancer.RemovedStats]. Those removed longest ago are dropped
+	// first. 0 keeps none.
+	TombstoneSize int
+	// Maximum number of handlers, installed and removed, whose state is
+	// kept, to bound the memory of a long-lived load balancer whose handlers
+	// keep changing. Once over it, the state kept of the handlers removed
+	// longest ago is dropped first, see [LoadBalancer.RemovedStats]; that of
+	// installed handlers is never dropped. 0 is no limit.
+	MaxTrackedHandlers int
+	// Called with every attempt on handlers being traced, see
+	// [LoadBalancer.Trace]. Called from the dispatching goroutine.
+	OnTrace func(TraceEvent) `json:"-"`
+	// If set, called with a report of every tick once it is done. Called
+	// from the goroutine running the ticks, so it should return quickly.
+	OnTick func(TickReport) `json:"-"`
+
+	// If set, every tick the samples of each handler are shared with other
+	// load balancer instances in front of the same handlers through this, and
+	// capacities are estimated from the combined traffic of all of them.
+	// See [Coordinator].
+	Coordinator Coordinator `json:"-"`
+	// Identifies this instance to the [Config.Coordinator]. Defaults to a
+	// random ID picked when the load balancer is created.
+	InstanceID string
+	// Fraction of each handler's [Handler.MaxRate] this instance may use,
+	// for when several instances share one quota. 0 uses all of it.
+	QuotaShare float64
+	// Divide each handler's [Handler.MaxRate] evenly between the live
+	// instances, as counted by the [Config.Coordinator] if it implements
+	// [InstanceCounter]. Overrides [Config.QuotaShare] when it does.
+	LeaseQuota bool
+}
+
+// Returns the configuration new load balancers start with.
+func DefaultConfig() Config {
+	return Config{
+		BackoffMaxExponent:     10,
+		BackoffUnit:            100 * time.Millisecond,
+		UpdateInterval:         time.Second,
+		SmoothingFactor:        0.5,
+		LatencySmoothingFactor: 0.1,
+		WeightScale:            100,
+		MaxRounds:              100,
+		HintTrust:              0.5,
+		ExplorationRate:        0.1,
+		AIMDIncrease:           0.1,
+		AIMDDecreaseFactor:     0.9,
+		QuotaResetAfter:        time.Minute,
+		CacheTTL:               time.Minute,
+		CacheSize:              1024,
+		AuditLogSize:           100,
+		TombstoneSize:          64,
+		AffinityTTL:            time.Minute,
+		AffinitySize:           1024,
+		CoDelInterval:          100 * time.Millisecond,
+	}
 }
 
+// Spreads calls over a set of handlers in proportion to their estimated
+// capacities.
+//
+// Selection is deterministic apart from exploration: within each round of the
+// weighted round robin, handlers are chosen in the order they were given to
+// [NewLoadBalancer], weights rounded from equal capacities are equal (ties in
+// rounding go to the earlier handler), and weight updates keep the current
+// position in the round instead of starting over. So two load balancers with
+// the same handlers and the same observations route identically. Set
+// [Config.ExplorationRate] to 0 to make selection fully deterministic.
 type LoadBalancer[T any, U any] struct {
 	Config
 
 	*rr.WeightedRoundRobin
 
-	dispatch   []HandlerFunc[T, U]
-	calls      []atomic.Int32 // counter of tasks run successfully each tick
-	rejections []atomic.Int32 // counter of ErrExceedCap each tick
-	caps       []float64      // estimated capacity of each handler, units of tasks per second
-	totalCap   float64        // sum of all caps
+	// If set, the load balancer runs in dry run mode: handlers are selected
+	// and accounted for as usual, but this is called with the index of the
+	// selected handler instead of the handler itself. Use it to see what a
+	// configuration would do with real traffic without sending any.
+	DryRun func(ctx context.Context, index int, param T) (U, error)
+	// If set, called on every response a handler returns without error.
+	// Returning an error makes the call count as failed, see
+	// [ErrInvalidResponse].
+	ValidateResponse func(U) error
+	// If set, successful responses are cached for [Config.CacheTTL] under the
+	// key this returns, and repeated requests with the same key are served
+	// from the cache without calling any handler. Return false to skip the
+	// cache for a request.
+	CacheKey func(T) (string, bool)
+	// If set, requests with the same key this returns prefer the handler
+	// that last succeeded for that key within [Config.AffinityTTL], e.g. to
+	// keep its caches warm. Requests fall through to the usual selection
+	// when that handler has no weight or can't take calls right now. Return
+	// false to skip affinity for a request.
+	AffinityKey func(T) (string, bool)
+	// If set, called when a dispatch is shed, e.g. under [Config.MaxInFlight]
+	// or for a deadline it can't meet, with the error it was shed with. What
+	// it returns goes to the caller instead, e.g. a degraded response or a
+	// cached value. Shed dispatches only go to the fallbacks, see
+	// [LoadBalancer.WithFallback], if this isn't set.
+	OnShed func(ctx context.Context, param T, err error) (U, error)
+
+	*handlerSet[T, U] // the installed set, see install
 
-	mut  sync.Mutex
-	done chan struct{}
+	fallbacks    []HandlerFunc[T, U]
+	producer     *rate.Limiter                    // paces callers of Pace to the total capacity
+	totalCap     float64                          // sum of all caps
+	cache        cache[U]                         // responses cached under CacheKey
+	failures     cache[error]                     // hard failures cached under CacheKey
+	research     *csv.Writer                      // writes to ResearchLog, created on first use
+	affinity     cache[int]                       // identity of the handler that last succeeded for each AffinityKey
+	affinityHits atomic.Int64                     // dispatches sent to the handler of their AffinityKey
+	recordErrors atomic.Int64                     // attempts Config.Recorder failed to write
+	admission    admission                        // dispatches running and waiting under MaxInFlight
+	instanceID   string                           // default for Config.InstanceID
+	overhead     overhead                         // cost of the load balancer itself
+	strategy     Strategy                         // chooses handlers, see SetStrategy
+	current      atomic.Pointer[handlerSet[T, U]] // the installed set, for use without the lock
+	lastID       int                              // identity of the last handler added
+	rebalanced   time.Time                        // when handlers last came or went without RebalanceDebounce holding it back
+	rebalancing  *time.Timer                      // pending rebalance held back by RebalanceDebounce, nil if none
+	published    atomic.Pointer[HistoryEntry]     // weights and caps as of the last update, see Current
+
+	history ring[HistoryEntry] // past weights and caps, one entry per tick
+	audit   ring[AuditEvent]   // changes made at runtime, see AuditLog
+
+	tombstones []tombstone // removed handlers, removed longest ago first
+
+	mut     sync.Mutex
+	changed chan struct{} // closed and replaced every time the weights change
+	done    chan struct{}
 }
 
+// Creates a load balancer over the given handlers. Calling this without any
+// handlers is allowed, but every [LoadBalancer.Dispatch] will fail with
+// [ErrNoHandlers].
 func NewLoadBalancer[T any, U any](handlers ...Handler[T, U]) *LoadBalancer[T, U] {
-	n := len(handlers)
 	lb := LoadBalancer[T, U]{
-		dispatch:           make([]HandlerFunc[T, U], n),
-		calls:              make([]atomic.Int32, n),
-		rejections:         make([]atomic.Int32, n),
-		caps:               make([]float64, n),
+		producer:           rate.NewLimiter(rate.Inf, 1),
 		totalCap:           0,
+		instanceID:         strconv.FormatUint(rand.Uint64(), 36),
 		mut:                sync.Mutex{},
+		changed:            make(chan struct{}),
 		done:               make(chan struct{}, 2),
-		WeightedRoundRobin: rr.NewWeightedRoundRobin(make([]int, n)),
-		Config: Config{
-			BackoffMaxExponent: 10,
-			BackoffUnit:        100 * time.Millisecond,
-			UpdateInterval:     time.Second,
-			SmoothingFactor:    0.5,
-			ExplorationRate:    0.1,
-			AIMDIncrease:       0.1,
-			AIMDDecreaseFactor: 0.9,
-		},
+		WeightedRoundRobin: rr.NewWeightedRoundRobin(make([]int, len(handlers))),
+		Config:             DefaultConfig(),
 	}
+	lb.strategy = wrrStrategy{lb.WeightedRoundRobin}
 
-	for i, ds := range handlers {
-		lb.dispatch[i] = ds.Dispatch
-		lb.caps[i] = max(ds.EstCap, 1)
+	set := &handlerSet[T, U]{}
+	for _, h := range handlers {
+		set = set.add(h, lb.newID())
 	}
-
+	lb.install(set)
 	lb.updateWeights()
 
 	return &lb
 }
 
 func (l *LoadBalancer[T, U]) spin() {
+	jitter := min(max(l.TickJitter, 0), 1)
+	if phase := time.Duration(rand.Float64() * jitter * float64(l.UpdateInterval)); phase > 0 {
+		select {
+		case <-time.After(phase):
+			// Start the first interval afresh so it is a whole one
+			l.takeSamples(l.handlers())
+		case <-l.done:
+			return
+		}
+	}
 	ticker := time.NewTicker(l.UpdateInterval)
 	for {
 		select {
-		case <-ticker.C:
-			l.mut.Lock()
-			l.updateLoads()
-			l.updateWeights()
-			l.mut.Unlock()
+		case t := <-ticker.C:
+			l.tick(t)
 		case <-l.done:
 			ticker.Stop()
 			return
@@ -102,6 +408,61 @@ func (l *LoadBalancer[T, U]) spin() {
 	}
 }
 
+// Runs a single update cycle.
+func (l *LoadBalancer[T, U]) tick(t time.Time) {
+	start := time.Now()
+	defer func() {
+		elapsed := int64(time.Since(start))
+		l.overhead.ticks.Add(1)
+		l.overhead.tickTime.Add(elapsed)
+		l.overhead.lastTick.Store(elapsed)
+	}()
+	set := l.handlers()
+	samples := l.takeSamples(set)
+	local := slices.Clone(samples)
+	if l.Coordinator != nil {
+		samples = l.coordinate(set, samples)
+	}
+	l.shareQuota(set)
+	l.admission.tick(t)
+
+	l.lock()
+	samples = l.align(set, samples)
+	local = l.align(set, local)
+	var report TickReport
+	if l.OnTick != nil {
+		report = l.startReport(t, local)
+	}
+	l.applySamples(samples)
+	l.endQuarantines()
+	l.updateWeights()
+	l.history.add(l.HistorySize, l.snapshot(t))
+	if l.OnTick != nil {
+		l.finishReport(&report)
+	}
+	l.mut.Unlock()
+
+	if l.OnTick != nil {
+		l.OnTick(report)
+	}
+}
+
+// Synchronously runs a single update cycle, exactly as if one
+// [Config.UpdateInterval] had passed. Meant for tests and simulations that want
+// to step the estimator deterministically without calling
+// [LoadBalancer.Start].
+func (l *LoadBalancer[T, U]) TickOnce() {
+	l.tick(l.now())
+}
+
+// Returns the current time on [Config.Now].
+func (l *LoadBalancer[T, U]) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+	return time.Now()
+}
+
 // Starts the auto weight adjustment behavior. Without this it's just a dumb
 // round robin scheduler.
 func (l *LoadBalancer[T, U]) Start() {
@@ -110,110 +471,617 @@ func (l *LoadBalancer[T, U]) Start() {
 
 // Stops the load balancer. You can still call `Dispatch` afterwards but the
 // weights will stop updating, and there is no guarantee on its behavior. Don't
-// do that!
+// do that! See [LoadBalancer.Shutdown] to let running dispatches finish first.
 func (l *LoadBalancer[T, U]) Destroy() {
+	l.mut.Lock()
+	if l.rebalancing != nil {
+		l.rebalancing.Stop()
+		l.rebalancing = nil
+	}
+	l.mut.Unlock()
 	l.done <- struct{}{}
 }
 
 // Average the current loads into the existing capacities, and reset the load
 // counters.
 func (l *LoadBalancer[T, U]) updateLoads() {
-	for i := range l.calls {
-		calls := l.calls[i].Load()
-		rejects := l.rejections[i].Load()
-
-		// AIMD: additive increase for successes
-		if calls > 0 {
-			l.caps[i] += l.AIMDIncrease
-		}
+	l.applySamples(l.takeSamples(l.handlerSet))
+}
 
-		// AIMD: multiplicative decrease for rejections
-		if rejects > 0 {
-			l.caps[i] *= l.AIMDDecreaseFactor
+// Takes a sample of what each handler of s did since the last call and resets
+// the load counters. Handlers out of quota keep their estimate for when they
+// come back, so their sample is nil.
+func (l *LoadBalancer[T, U]) takeSamples(s *handlerSet[T, U]) []*Sample {
+	now := l.now()
+	samples := make([]*Sample, len(s.successes))
+	for i := range s.successes {
+		errs := s.errors[i].Load()
+		calls := s.successes[i].Load() + errs
+		rejects := s.rejections[i].Reset()
+		latencies := s.latencies[i].Swap(0)
+		peak := s.peakInFlight[i].Swap(s.inFlight[i].Load())
+		if !s.exhausted(i, now) {
+			sample := &Sample{
+				Calls:      float64(calls),
+				Errors:     float64(errs),
+				Rejections: float64(rejects),
+				InFlight:   int(peak),
+				Period:     l.UpdateInterval,
+			}
+			if calls > 0 {
+				sample.Latency = time.Duration(latencies / int64(calls))
+			}
+			if u := l.utilization(); u < 1 {
+				// Paced below capacity, scale back up to what the
+				// handler could have done.
+				sample.Calls /= u
+				sample.Errors /= u
+			}
+			samples[i] = sample
 		}
+		s.successes[i].Store(0)
+		s.errors[i].Store(0)
+	}
+	return samples
+}
 
-		// Exponential smoothing for observed rate
-		if calls > 0 || rejects > 0 {
-			estCap := float64(calls) / l.UpdateInterval.Seconds()
-			l.caps[i] = l.SmoothingFactor*estCap + (1-l.SmoothingFactor)*l.caps[i]
+// Feeds the samples from [LoadBalancer.takeSamples] into the capacity estimates.
+func (l *LoadBalancer[T, U]) applySamples(samples []*Sample) {
+	for i, sample := range samples {
+		if sample != nil {
+			l.updateLoad(i, *sample)
 		}
+		l.updatePenalty(i, sample)
+	}
+}
 
-		// Decay for idle handlers to prevent starvation
-		if calls == 0 && rejects == 0 {
-			l.caps[i] *= 0.99
-		}
+// Feeds a sample of what handler i did into its capacity estimate.
+func (l *LoadBalancer[T, U]) updateLoad(i int, sample Sample) {
+	capacity := l.clampCap(i, l.estimator(i).Estimate(l.configFor(i), l.caps[i], sample))
+	if l.ResearchLog != nil {
+		l.logEstimate(i, sample, capacity)
+	}
+	l.caps[i] = capacity
+}
 
-		l.caps[i] = max(l.caps[i], 0.1)
-		l.calls[i].Store(0)
-		l.rejections[i].Store(0)
+// Keeps the capacity of handler i within sane bounds.
+func (s *handlerSet[T, U]) clampCap(i int, c float64) float64 {
+	c = max(c, 0.1)
+	if s.maxRates[i] > 0 {
+		c = min(c, s.maxRates[i])
 	}
+	return c
 }
 
 // After updating any of the capacities, call this function to rebalance the
-// other variables.
+// other variables. Handlers that are out of quota get no weight.
 func (l *LoadBalancer[T, U]) updateWeights() {
+	l.setWeights(nil)
+}
+
+// Like [LoadBalancer.updateWeights], but the handlers get the given weights
+// instead of ones computed from their capacities, unless weights is nil.
+// Everything else, e.g. the total capacity and pacing, is updated the same.
+func (l *LoadBalancer[T, U]) setWeights(weights []int) {
+	now := l.now()
 	l.totalCap = 0
-	for _, c := range l.caps {
-		l.totalCap += c
-	}
-	newWeights := make([]int, len(l.dispatch))
+	shares := make([]float64, len(l.caps))
+	hold := l.holdQuarantined(now)
 	for i, c := range l.caps {
-		weight := int(c / l.totalCap * 100)
-		newWeights[i] = weight
+		if !l.exhausted(i, now) && !(hold && l.quarantined(i)) {
+			c *= l.multiplier(i, now)
+			l.totalCap += c
+			shares[i] = c * (1 - l.penalties[i])
+		}
+	}
+	if weights == nil {
+		l.weighLatency(shares)
+		l.blendHints(shares)
+		weights = l.weigh(shares)
+	}
+	l.SetMaxRounds(l.MaxRounds)
+	l.UpdateWeights(weights)
+	l.weights = slices.Clone(l.WeightedRoundRobin.GetWeights())
+	l.strategy.SetWeights(l.weights)
+	l.pace()
+	l.publish(now)
+
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Moves the shares of handlers with a weight hint towards their hint. The
+// capacity of the hinted handlers is redistributed between them in proportion
+// to their hints, and blended with what was learned by [Config.HintTrust].
+func (l *LoadBalancer[T, U]) blendHints(shares []float64) {
+	trust := min(max(l.HintTrust, 0), 1)
+	if trust == 0 {
+		return
+	}
+
+	var hintSum, capSum float64
+	for i, h := range l.hints {
+		if h > 0 && shares[i] > 0 {
+			hintSum += h
+			capSum += shares[i]
+		}
+	}
+	if hintSum == 0 {
+		return
+	}
+
+	for i, h := range l.hints {
+		if h > 0 && shares[i] > 0 {
+			shares[i] = (1-trust)*shares[i] + trust*capSum*h/hintSum
+		}
 	}
-	l.UpdateWeights(newWeights)
 }
 
 // Return this error to signal that the function has been called too quickly,
 // triggers an exponential backoff to start.
 var ErrExceedCap = errors.New("lb exceed capacity")
 
-func (l *LoadBalancer[T, U]) backoff(i int) {
-	exp := min(l.BackoffMaxExponent, i)
-	time.Sleep(l.BackoffUnit * 1 << exp)
+// Returned by [LoadBalancer.Dispatch] when the load balancer has no handlers to
+// dispatch to.
+var ErrNoHandlers = errors.New("lb has no handlers")
+
+// Returned by [LoadBalancer.Dispatch] when the load balancer has handlers but
+// none of them can take a call, for some other reason than being out of quota.
+var ErrUnavailable = errors.New("lb no handler available")
+
+// Returns how long to back off for after attempt number attempts on handler i
+// of s was rejected, see [HandlerOverrides.MaxBackoff].
+func (l *LoadBalancer[T, U]) backoff(s *handlerSet[T, U], i int, attempts int) time.Duration {
+	ceiling := s.overrides[i].MaxBackoff
+	if ceiling <= 0 {
+		exp := min(l.BackoffMaxExponent, attempts)
+		return l.BackoffUnit * 1 << exp
+	}
+	wait := l.BackoffUnit
+	for range attempts {
+		if wait >= ceiling {
+			break
+		}
+		wait *= 2
+	}
+	return min(wait, ceiling)
+}
+
+// Returned by [LoadBalancer.Dispatch], wrapping the error returned by
+// [LoadBalancer.ValidateResponse], when a handler's response fails validation.
+// Such calls count as failed, so with [Config.WeightByGoodput] handlers
+// returning garbage get less traffic.
+var ErrInvalidResponse = errors.New("lb invalid response")
+
+// Calls the handler once, recording the attempt if needed.
+func (l *LoadBalancer[T, U]) call(ctx context.Context, param T, s *handlerSet[T, U], index int) (U, error) {
+	dispatch := s.dispatch[index]
+	if l.DryRun != nil {
+		dispatch = func(ctx context.Context, param T) (U, error) {
+			return l.DryRun(ctx, index, param)
+		}
+	}
+	if l.ValidateResponse != nil {
+		unvalidated := dispatch
+		dispatch = func(ctx context.Context, param T) (U, error) {
+			res, err := unvalidated(ctx, param)
+			if err == nil {
+				if verr := l.ValidateResponse(res); verr != nil {
+					err = fmt.Errorf("%w: %w", ErrInvalidResponse, verr)
+				}
+			}
+			return res, err
+		}
+	}
+
+	inFlight := s.inFlight[index].Add(1)
+	for peak := s.peakInFlight[index].Load(); inFlight > peak; peak = s.peakInFlight[index].Load() {
+		if s.peakInFlight[index].CompareAndSwap(peak, inFlight) {
+			break
+		}
+	}
+	start := time.Now()
+	res, err := dispatch(ctx, param)
+	latency := time.Since(start)
+	s.inFlight[index].Add(-1)
+
+	outcome := outcomeOf(err)
+	if cancelled(ctx, err) {
+		outcome = OutcomeCancelled
+	}
+	if outcome == OutcomeSuccess || outcome == OutcomeError {
+		s.latencies[index].Add(int64(latency))
+		s.observeLatency(index, l.LatencySmoothingFactor, latency)
+	}
+	if l.OnTrace != nil && s.tracing(index, start) {
+		l.OnTrace(TraceEvent{
+			Time:    start,
+			Index:   index,
+			Name:    s.names[index],
+			Outcome: outcome,
+			Latency: latency,
+			Err:     err,
+		})
+	}
+	l.recordAttempt(Record{
+		Time:    start,
+		Handler: index,
+		ID:      s.ids[index],
+		Outcome: outcome,
+		Latency: latency,
+	})
+
+	return res, err
 }
 
-func (l *LoadBalancer[T, U]) tryDispatch(ctx context.Context, param T, index int) (U, error) {
+// Dispatches to handler index of s, backing off and retrying as needed. s is
+// the set the handler was picked from, it may no longer be installed.
+func (l *LoadBalancer[T, U]) tryDispatch(ctx context.Context, param T, s *handlerSet[T, U], index int, opts DispatchOpts) (U, error) {
 	var res U
 	var err error
 	attempts := 0
+	if opts.handlerFailed != nil {
+		*opts.handlerFailed = false
+	}
 L:
 	for {
 		select {
 		case <-ctx.Done():
 			return res, ctx.Err()
 		default:
-			res, err = l.dispatch[index](ctx, param)
+			if opts.OnAttempt != nil {
+				if err := opts.OnAttempt(attempts, index); err != nil {
+					return res, err
+				}
+			}
+			if s.limiters[index] != nil {
+				if err := s.limiters[index].Wait(ctx); err != nil {
+					return res, err
+				}
+			}
+			if err := s.pacers[index].Wait(ctx); err != nil {
+				return res, err
+			}
+			if l.ShedUnmeetable && s.unmeetable(ctx, index) {
+				return res, ErrDeadlineUnmeetable
+			}
+			retry := !opts.NoRetry && !noRetry(ctx)
+			attemptCtx, cancel := l.attemptContext(ctx, l.backoff(s, index, attempts), retry)
+			info := DispatchInfo{
+				Index:   index,
+				Name:    s.names[index],
+				Attempt: attempts,
+				Data:    s.data[index],
+				Explore: opts.explore,
+			}
+			if opts.onAttempt != nil {
+				opts.onAttempt(info)
+			}
+			attemptCtx = withDispatchInfo(attemptCtx, info)
+			res, err = l.call(attemptCtx, param, s, index)
+			timedOut := attemptCtx.Err() != nil && ctx.Err() == nil
+			cancel()
+			if cancelled(ctx, err) {
+				// Says nothing about the handler, don't count it
+				return res, err
+			}
+			if timedOut && !opts.pinned && errors.Is(err, context.DeadlineExceeded) {
+				// Ran out of its share of the time, try another handler
+				// while there still is time to.
+				s.errors[index].Add(1)
+				return res, errDeflected
+			}
 			if !errors.Is(err, ErrExceedCap) {
 				break L
 			}
-			l.rejections[index].Add(1)
-			l.backoff(attempts)
+			s.rejections[index].Add(1)
+			if !retry {
+				return res, err
+			}
+			wait := l.backoff(s, index, attempts)
+			now := l.now()
+			s.coolDown(index, now, wait)
+			if l.Deflect && !opts.pinned && s.canDeflect(index, now) {
+				s.deflections[index].Add(1)
+				return res, errDeflected
+			}
+			l.overhead.backingOff.Add(1)
+			time.Sleep(wait)
+			l.overhead.backingOff.Add(-1)
 			attempts++
 		}
 	}
 
-	l.calls[index].Add(1)
+	if errors.Is(err, ErrQuotaExhausted) {
+		// Says nothing about the handler's capacity, don't count it
+		return res, err
+	}
+	if opts.explore {
+		s.explorations[index].Add(1)
+		if err != nil {
+			s.exploreErrors[index].Add(1)
+		}
+	}
+	switch {
+	case err == nil:
+		s.successes[index].Add(1)
+	case !(opts.explore && l.ExcludeExplorationErrors):
+		s.errors[index].Add(1)
+	}
+	s.lastCompleted[index].Store(time.Now().UnixNano())
+	if opts.handlerFailed != nil {
+		*opts.handlerFailed = err != nil
+	}
 
 	return res, err
 }
 
+// Per call options for [LoadBalancer.DispatchWithOpts].
+type DispatchOpts struct {
+	// Called before every attempt with the attempt number on the handler,
+	// starting from 0, and the index of the handler about to be called. Returning an error
+	// aborts the dispatch with that error.
+	OnAttempt func(attempt int, index int) error
+	// Return [ErrExceedCap] to the caller instead of backing off and
+	// retrying. Also see [NoRetry].
+	NoRetry bool
+
+	pinned    bool               // the call must go to this handler, never send it elsewhere
+	explore   bool               // the handler was chosen by exploration
+	onAttempt func(DispatchInfo) // called with every attempt made
+
+	handlerFailed *bool // set to whether the error the call ended with was returned by the handler
+}
+
+type noRetryKey struct{}
+
+// Returns a context that disables retries for any dispatch made with it, as if
+// [DispatchOpts.NoRetry] was set. Useful when the caller already retries.
+func NoRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRetryKey{}, true)
+}
+
+func noRetry(ctx context.Context) bool {
+	v, _ := ctx.Value(noRetryKey{}).(bool)
+	return v
+}
+
 // Tries to call one of the available handlers.
 func (l *LoadBalancer[T, U]) Dispatch(ctx context.Context, param T) (U, error) {
-	l.mut.Lock()
-	var index int
-	if l.ExplorationRate > 0 && len(l.dispatch) > 1 && rand.Float64() < l.ExplorationRate {
-		index = rand.Intn(len(l.dispatch))
+	return l.DispatchWithOpts(ctx, param, DispatchOpts{})
+}
+
+// Like [LoadBalancer.Dispatch], with extra options for this call only.
+func (l *LoadBalancer[T, U]) DispatchWithOpts(ctx context.Context, param T, opts DispatchOpts) (U, error) {
+	var res U
+	var err error
+	key, cached := "", false
+	if l.CacheKey != nil {
+		key, cached = l.CacheKey(param)
+	}
+	if cached {
+		res, err = l.dispatchCached(ctx, param, opts, key)
 	} else {
-		index = l.WeightedRoundRobin.Dispatch()
+		res, err = l.dispatchUncached(ctx, param, opts)
 	}
-	l.mut.Unlock()
+	if err != nil && l.OnShed != nil && errors.Is(err, ErrShed) {
+		return l.OnShed(ctx, param, err)
+	}
+	if err != nil && len(l.fallbacks) > 0 && unavailable(err) {
+		return l.fallback(ctx, param, err)
+	}
+	return res, err
+}
+
+// Serves the request from the cache if possible, otherwise dispatches it and
+// caches the response, or with [Config.NegativeCacheTTL] the failure if the
+// handler returned it. Failures of the load balancer itself, e.g. waiting for
+// a rate limit past the deadline or [DispatchOpts.OnAttempt] aborting, say
+// nothing about the request.
+func (l *LoadBalancer[T, U]) dispatchCached(ctx context.Context, param T, opts DispatchOpts, key string) (U, error) {
+	now := time.Now()
+	if res, ok := l.cache.get(key, now); ok {
+		return res, nil
+	}
+	if l.NegativeCacheTTL > 0 {
+		if err, ok := l.failures.get(key, now); ok {
+			var res U
+			return res, err
+		}
+	}
+
+	var handlerFailed bool
+	opts.handlerFailed = &handlerFailed
+	res, err := l.dispatchUncached(ctx, param, opts)
+	if err == nil {
+		l.cache.put(key, res, time.Now().Add(l.CacheTTL), l.CacheSize)
+	} else if l.NegativeCacheTTL > 0 && handlerFailed && hardFailure(err) {
+		cached := fmt.Errorf("%w: %w", ErrCachedFailure, err)
+		l.failures.put(key, cached, time.Now().Add(l.NegativeCacheTTL), l.CacheSize)
+	}
+	return res, err
+}
+
+func (l *LoadBalancer[T, U]) dispatchUncached(ctx context.Context, param T, opts DispatchOpts) (U, error) {
+	slots, err := l.admit(ctx)
+	if err != nil {
+		var res U
+		return res, err
+	}
+	defer l.release(slots)
 
-	return l.tryDispatch(ctx, param, index)
+	key, sticky := "", false
+	if l.AffinityKey != nil {
+		key, sticky = l.AffinityKey(param)
+	}
+	for attempt := 0; ; attempt++ {
+		var set *handlerSet[T, U]
+		index, ok, explore := 0, false, false
+		if sticky && attempt == 0 {
+			set, index, ok = l.stickTo(key)
+		}
+		if !ok {
+			var err error
+			set, index, explore, err = l.pick()
+			if err != nil {
+				var res U
+				return res, err
+			}
+		}
+
+		opts.explore = explore
+		res, err := l.tryDispatch(ctx, param, set, index, opts)
+		if sticky && err == nil {
+			l.affinity.put(key, set.ids[index], time.Now().Add(l.AffinityTTL), l.AffinitySize)
+		}
+		if errors.Is(err, errDeflected) {
+			continue
+		}
+		if !errors.Is(err, ErrQuotaExhausted) {
+			return res, err
+		}
+		// Take it out of rotation and try someone else
+		l.exhaust(set, index, err)
+	}
+}
+
+// Chooses the handler to dispatch to, skipping handlers that are out of quota,
+// and with [Config.Deflect] also those cooling down if possible. Returns the
+// set it was chosen from and its index there, and whether it was chosen by
+// exploration.
+func (l *LoadBalancer[T, U]) pick() (*handlerSet[T, U], int, bool, error) {
+	set := l.handlers()
+	n := len(set.dispatch)
+	began, now := time.Now(), l.now()
+	defer func() {
+		l.overhead.selections.Add(1)
+		l.overhead.selectionTime.Add(int64(time.Since(began)))
+	}()
+	switch n {
+	case 0:
+		return set, 0, false, ErrNoHandlers
+	case 1:
+		// Nothing to choose from, skip the lock and the scheduler. Being
+		// quarantined doesn't hold back the only handler there is.
+		if set.exhausted(0, now) {
+			return set, 0, false, set.quotaError(now)
+		}
+		return set, 0, false, nil
+	}
+
+	l.lock()
+	defer l.mut.Unlock()
+	// Handlers may have come or gone since
+	set, n = l.handlerSet, len(l.dispatch)
+	if n == 0 {
+		return set, 0, false, ErrNoHandlers
+	}
+	avoidCoolDown := l.Deflect
+	if l.ExplorationRate > 0 && rand.Float64() < l.ExplorationRate {
+		index := l.explore(began)
+		if l.routable(index, now, avoidCoolDown) {
+			return set, index, true, nil
+		}
+	}
+	hold := l.holdQuarantined(now)
+	index, ok := l.strategy.Next(func(index int) bool {
+		return l.routable(index, now, avoidCoolDown) && !(hold && l.quarantined(index))
+	})
+	if ok {
+		return set, index, false, nil
+	}
+	// The strategy only offered handlers we can't use, look at everyone
+	// else before settling for one that's cooling down. Start from where the
+	// scheduler is so the order stays deterministic.
+	start := l.WeightedRoundRobin.Peek()
+	for _, avoid := range []bool{avoidCoolDown, false} {
+		for k := range n {
+			index := (start + k) % n
+			if l.routable(index, now, avoid) && !(hold && l.quarantined(index)) {
+				return set, index, false, nil
+			}
+		}
+	}
+	return set, 0, false, set.quotaError(now)
+}
+
+// Picks a handler to explore, with probability proportional to how long it has
+// been since it last completed a call, plus one update interval so that
+// handlers with fresh estimates still get explored occasionally.
+func (l *LoadBalancer[T, U]) explore(now time.Time) int {
+	staleness := make([]float64, len(l.lastCompleted))
+	total := 0.0
+	for i := range l.lastCompleted {
+		since := now.UnixNano() - l.lastCompleted[i].Load()
+		staleness[i] = float64(max(since, 0) + int64(l.UpdateInterval) + 1)
+		total += staleness[i]
+	}
+
+	target := rand.Float64() * total
+	for i, s := range staleness {
+		target -= s
+		if target < 0 {
+			return i
+		}
+	}
+	return len(staleness) - 1
 }
 
 // Returns the currently used weights. Doesn't really mean much, but useful for
-// testing/debugging.
+// testing/debugging. See [LoadBalancer.Current] to get them along with the
+// capacities.
 func (l *LoadBalancer[T, U]) GetWeights() []int {
-	return l.WeightedRoundRobin.GetWeights()
+	return l.Current().Weights
+}
+
+// Returns a copy of the currently estimated capacities of each handler, in
+// units of tasks per second.
+func (l *LoadBalancer[T, U]) GetCapacities() []float64 {
+	return l.Current().Caps
+}
+
+// Replaces the estimated capacities of all handlers at once and rebalances the
+// weights, so that no dispatch ever sees a partially updated set of weights.
+// Useful for installing estimates from an external optimizer between ticks. The
+// estimates will continue to be adjusted as usual afterwards.
+func (l *LoadBalancer[T, U]) SetAllCapacities(caps []float64) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if len(caps) != len(l.caps) {
+		return fmt.Errorf("lb got %d capacities for %d handlers", len(caps), len(l.caps))
+	}
+
+	before := l.auditState()
+	l.setCapacities(caps)
+	l.record("set_capacities", "", before)
+
+	return nil
+}
+
+// Like [LoadBalancer.SetAllCapacities] without checking or auditing. Needs the
+// lock.
+func (l *LoadBalancer[T, U]) setCapacities(caps []float64) {
+	for i, c := range caps {
+		l.caps[i] = l.clampCap(i, c)
+	}
+	l.updateWeights()
+}
+
+// Replaces the weight hints of all handlers, see [Handler.WeightHint], and
+// rebalances the weights. Use it when discovery reports new hints.
+func (l *LoadBalancer[T, U]) SetWeightHints(hints []float64) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if len(hints) != len(l.hints) {
+		return fmt.Errorf("lb got %d weight hints for %d handlers", len(hints), len(l.hints))
+	}
+
+	before := l.auditState()
+	for i, h := range hints {
+		l.hints[i] = max(h, 0)
+	}
+	l.updateWeights()
+	l.record("set_weight_hints", "", before)
+
+	return nil
 }
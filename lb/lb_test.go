@@ -2,7 +2,9 @@ package lb_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -110,3 +112,328 @@ L:
 		assert.InDelta(t, weight, w, acceptableDelta, "handler %d", i)
 	}
 }
+
+func TestNoHandlers(t *testing.T) {
+	balancer := lb.NewLoadBalancer[int, int]()
+	balancer.Start()
+	defer balancer.Destroy()
+
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrNoHandlers)
+	assert.Empty(t, balancer.GetWeights())
+}
+
+func TestSingleHandler(t *testing.T) {
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			return param * 2, nil
+		},
+	})
+
+	for i := range 10 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		assert.Equal(t, i*2, res)
+	}
+	assert.Equal(t, 10, calls)
+	assert.Equal(t, []int{100}, balancer.GetWeights())
+}
+
+func TestSetAllCapacities(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+
+	err := balancer.SetAllCapacities([]float64{10, 30, 60})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{10, 30, 60}, balancer.GetCapacities())
+	assert.Equal(t, []int{10, 30, 60}, balancer.GetWeights())
+
+	err = balancer.SetAllCapacities([]float64{1, 2})
+	assert.Error(t, err)
+	assert.Equal(t, []int{10, 30, 60}, balancer.GetWeights())
+}
+
+func TestWeightHints(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1, 1)
+	downstreams[0].WeightHint = 3
+	downstreams[1].WeightHint = 1
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.HintTrust = 1
+
+	// The hinted handlers split their capacity 3 to 1, the other is
+	// unaffected.
+	assert.NoError(t, balancer.SetAllCapacities([]float64{10, 10, 10}))
+	assert.Equal(t, []int{50, 17, 33}, balancer.GetWeights())
+
+	balancer.HintTrust = 0
+	assert.NoError(t, balancer.SetWeightHints([]float64{1, 3, 0}))
+	assert.Equal(t, []int{34, 33, 33}, balancer.GetWeights())
+
+	balancer.HintTrust = 0.5
+	assert.NoError(t, balancer.SetWeightHints([]float64{3, 1, 0}))
+	assert.Equal(t, []int{42, 25, 33}, balancer.GetWeights())
+
+	assert.Error(t, balancer.SetWeightHints([]float64{1}))
+}
+
+func TestDryRun(t *testing.T) {
+	called := false
+	handler := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			called = true
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler, handler)
+	balancer.ExplorationRate = 0
+
+	var chosen []int
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		chosen = append(chosen, index)
+		return -1, nil
+	}
+
+	for i := range 4 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		assert.Equal(t, -1, res)
+	}
+	assert.False(t, called)
+	assert.Equal(t, []int{0, 1, 0, 1}, chosen)
+}
+
+func TestOnAttempt(t *testing.T) {
+	errGiveUp := errors.New("give up")
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, lb.ErrExceedCap
+		},
+	})
+	balancer.BackoffUnit = time.Millisecond
+
+	var attempts []int
+	_, err := balancer.DispatchWithOpts(context.Background(), 1, lb.DispatchOpts{
+		OnAttempt: func(attempt int, index int) error {
+			assert.Equal(t, 0, index)
+			attempts = append(attempts, attempt)
+			if attempt == 3 {
+				return errGiveUp
+			}
+			return nil
+		},
+	})
+	assert.ErrorIs(t, err, errGiveUp)
+	assert.Equal(t, []int{0, 1, 2, 3}, attempts)
+}
+
+func TestMaxRate(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap:  100,
+		MaxRate: 20,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	assert.Equal(t, []float64{20}, balancer.GetCapacities())
+
+	start := time.Now()
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	// the first call goes through immediately, the rest are 50ms apart
+	assert.GreaterOrEqual(t, time.Since(start), 440*time.Millisecond)
+
+	balancer.SetAllCapacities([]float64{50})
+	assert.Equal(t, []float64{20}, balancer.GetCapacities())
+}
+
+// Tests that stepping the estimator by hand moves capacity towards the handler
+// that served the calls.
+func TestTickOnce(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1000, 1000)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.ExplorationRate = 0
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		if index == 1 {
+			return 0, lb.ErrExceedCap
+		}
+		return param, nil
+	}
+	balancer.BackoffUnit = 0
+
+	for range 5 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		for range 10 {
+			balancer.Dispatch(ctx, 1)
+		}
+		cancel()
+		balancer.TickOnce()
+	}
+
+	weights := balancer.GetWeights()
+	assert.Greater(t, weights[0], 90)
+	assert.Less(t, weights[1], 10)
+}
+
+// Tests that instances started together don't tick together with TickJitter.
+func TestTickJitter(t *testing.T) {
+	start := time.Now()
+	firstTicks := make(chan time.Duration, 5)
+	for range 5 {
+		balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+		balancer.UpdateInterval = 100 * time.Millisecond
+		balancer.TickJitter = 1
+		var once sync.Once
+		balancer.OnTick = func(lb.TickReport) {
+			once.Do(func() { firstTicks <- time.Since(start) })
+		}
+		balancer.Start()
+		defer balancer.Destroy()
+	}
+
+	var delays []time.Duration
+	for range 5 {
+		delay := <-firstTicks
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.Less(t, delay, 300*time.Millisecond)
+		delays = append(delays, delay)
+	}
+	assert.Greater(t, slices.Max(delays)-slices.Min(delays), 10*time.Millisecond)
+}
+
+// Tests that weights always add up to the scale, without shortchanging the
+// smaller handlers.
+func TestWeightsSumToScale(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+
+	balancer.SetAllCapacities([]float64{1, 1, 1})
+	assert.Equal(t, []int{34, 33, 33}, balancer.GetWeights())
+
+	balancer.SetAllCapacities([]float64{96.4, 1.8, 1.8})
+	assert.Equal(t, []int{96, 2, 2}, balancer.GetWeights())
+
+	balancer.SetAllCapacities([]float64{0.1, 0.1, 1000})
+	assert.Equal(t, []int{0, 0, 100}, balancer.GetWeights())
+}
+
+func TestValidateResponse(t *testing.T) {
+	errNegative := errors.New("negative")
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.ValidateResponse = func(res int) error {
+		if res < 0 {
+			return errNegative
+		}
+		return nil
+	}
+
+	res, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+
+	_, err = balancer.Dispatch(context.Background(), -1)
+	assert.ErrorIs(t, err, lb.ErrInvalidResponse)
+	assert.ErrorIs(t, err, errNegative)
+}
+
+func TestNoRetry(t *testing.T) {
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			return 0, lb.ErrExceedCap
+		},
+	})
+
+	_, err := balancer.DispatchWithOpts(context.Background(), 1, lb.DispatchOpts{NoRetry: true})
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+	assert.Equal(t, 1, calls)
+
+	_, err = balancer.Dispatch(lb.NoRetry(context.Background()), 1)
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+	assert.Equal(t, 2, calls)
+}
+
+// Tests that identical load balancers route identically without exploration.
+func TestDeterministicOrder(t *testing.T) {
+	route := func() []int {
+		var order []int
+		handler := func(ctx context.Context, param int) (int, error) {
+			info, _ := lb.DispatchInfoFromContext(ctx)
+			order = append(order, info.Index)
+			return param, nil
+		}
+		balancer := lb.NewLoadBalancer(
+			lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+			lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+			lb.Handler[int, int]{EstCap: 20, Dispatch: handler},
+		)
+		balancer.ExplorationRate = 0
+		for i := range 10 {
+			balancer.Dispatch(context.Background(), i)
+		}
+		balancer.SetAllCapacities([]float64{10, 10, 10})
+		for i := range 10 {
+			balancer.Dispatch(context.Background(), i)
+		}
+		return order
+	}
+
+	first := route()
+	assert.Equal(t, first, route())
+	assert.Equal(t, []int{0, 1, 2, 0, 1, 2}, first[:6])
+}
+
+// Tests that quotas, cool downs and schedules go by the injected clock.
+func TestNow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	night := func(t time.Time) float64 {
+		if t.Hour() < 6 {
+			return 0
+		}
+		return 1
+	}
+	handler := func(schedule func(time.Time) float64) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			EstCap:           10,
+			CapacitySchedule: schedule,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				if param == 0 {
+					return 0, lb.ErrQuotaExhausted
+				}
+				return param, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler(nil), handler(night))
+	balancer.Now = func() time.Time { return now }
+	balancer.ExplorationRate = 0
+	balancer.QuotaResetAfter = time.Hour
+
+	balancer.TickOnce()
+	assert.Equal(t, []int{100, 0}, balancer.GetWeights())
+	now = now.Add(6 * time.Hour)
+	balancer.TickOnce()
+	assert.Equal(t, []int{50, 50}, balancer.GetWeights())
+
+	// Out of quota for an hour on the injected clock
+	_, err := balancer.Dispatch(context.Background(), 0)
+	var quotaErr *lb.QuotaExhaustedError
+	if assert.ErrorAs(t, err, &quotaErr) {
+		assert.WithinDuration(t, now.Add(time.Hour), quotaErr.Reset, 0)
+	}
+	assert.False(t, balancer.Healthy())
+	now = now.Add(time.Hour)
+	assert.True(t, balancer.Healthy())
+}
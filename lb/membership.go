@@ -0,0 +1,322 @@
+package lb
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/shard"
+	"golang.org/x/time/rate"
+)
+
+// The handlers and everything kept about each of them, in slices indexed by
+// handler. The length of a set never changes: adding or removing a handler
+// installs a new set instead, so a dispatch can keep using the set it picked
+// its handler from, without holding any lock, while handlers come and go. The
+// counters are pointers shared by the old and new sets so no call goes
+// uncounted. Everything that isn't a counter is only read or written with the
+// lock held, on the installed set.
+type handlerSet[T any, U any] struct {
+	ids            []int // stable identity of each handler, unlike its index
+	dispatch       []HandlerFunc[T, U]
+	schedules      []func(time.Time) float64
+	overrides      []HandlerOverrides
+	names          []string
+	data           []any
+	weights        []int            // round robin weight of each handler as of the last update
+	successes      []*atomic.Int32  // counter of tasks that succeeded each tick
+	errors         []*atomic.Int32  // counter of tasks that failed each tick
+	rejections     []*shard.Counter // counter of ErrExceedCap each tick, sharded to cut contention
+	caps           []float64        // estimated capacity of each handler, units of tasks per second
+	maxRates       []float64        // hard limit of each handler, 0 if none
+	hints          []float64        // weight hint of each handler, 0 if none
+	penalties      []float64        // share of the weight of each handler cut for errors
+	limiters       []*rate.Limiter  // paces calls to handlers with a hard limit, nil if none
+	pacers         []*rate.Limiter  // paces calls to TargetUtilization of each handler's capacity
+	exhaustedUntil []*atomic.Int64  // unix nanos until which each handler is out of quota
+	lastCompleted  []*atomic.Int64  // unix nanos of the last call each handler completed
+	estimators     []Estimator      // capacity estimator of each handler, created on first use
+	latencies      []*atomic.Int64  // total nanos spent in completed calls each tick
+	inFlight       []*atomic.Int32  // calls currently running on each handler
+	peakInFlight   []*atomic.Int32  // most calls running at once on each handler each tick
+	ewmaLatency    []*atomic.Int64  // moving average of the latency of each handler, in nanos
+	coolDownUntil  []*atomic.Int64  // unix nanos until which each handler is backing off after a rejection
+	deflections    []*atomic.Int64  // total rejected calls sent to another handler instead of waiting
+	explorations   []*atomic.Int64  // total exploratory calls completed by each handler
+	exploreErrors  []*atomic.Int64  // total exploratory calls that failed on each handler
+	traceUntil     []*atomic.Int64  // unix nanos until which attempts on each handler are traced
+	quarantine     []*probation     // trial of each quarantined handler, nil if not quarantined
+}
+
+// Adds a handler while the load balancer is running, e.g. when a backend is
+// scaled out, and returns its index. It starts from its [Handler.EstCap] like
+// the handlers given to [NewLoadBalancer], after proving itself if
+// [Config.QuarantineCalls] is set, and the weights are rebalanced right away.
+// Dispatches already running are not held up.
+func (l *LoadBalancer[T, U]) AddHandler(h Handler[T, U]) int {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	before := l.auditState()
+	next := l.handlerSet.add(h, l.newID())
+	l.resurrect(next, len(next.ids)-1)
+	l.quarantineNew(next)
+	old := l.handlerSet
+	l.install(next)
+	l.trimTombstones()
+	l.rebalance(old)
+	l.record("add_handler", "", before)
+	return len(l.dispatch) - 1
+}
+
+// Removes the handler at index while the load balancer is running, e.g. when a
+// backend is scaled in, and rebalances the weights. The handlers after it move
+// down by one, so indices held from before, e.g. from [LoadBalancer.AddHandler],
+// must be adjusted. Its final stats are kept, see [LoadBalancer.RemovedStats],
+// but everything else about it, e.g. its affinity entries, is dropped so it
+// isn't held on to once the dispatches already running on it finish. Panics if
+// there is no handler at index.
+func (l *LoadBalancer[T, U]) RemoveHandler(index int) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	before := l.auditState()
+	id := l.ids[index]
+	l.bury(index)
+	old := l.handlerSet
+	l.install(old.remove(index))
+	l.trimTombstones()
+	l.affinity.removeIf(func(affine int) bool { return affine == id })
+	l.rebalance(old)
+	l.record("remove_handler", "", before)
+}
+
+// Replaces the handlers with the given ones while the load balancer is running,
+// e.g. when service discovery returns a new list of backends. Handlers are
+// matched to the current ones by [Handler.Name]: those that match keep
+// everything learned about them, such as their capacity and penalty, while
+// their settings are taken from the given handler. Unnamed handlers and new
+// names are added as by [LoadBalancer.AddHandler], and current handlers with
+// no match are removed as by [LoadBalancer.RemoveHandler]. The handlers end up
+// at the same indices as in the given slice, and the weights are rebalanced
+// once for the whole change.
+func (l *LoadBalancer[T, U]) SetHandlers(handlers []Handler[T, U]) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	before := l.auditState()
+	old := l.handlerSet
+	byName := make(map[string][]int) // unmatched current handlers by name
+	for j, name := range old.names {
+		if name != "" {
+			byName[name] = append(byName[name], j)
+		}
+	}
+	next := &handlerSet[T, U]{}
+	for _, h := range handlers {
+		if js := byName[h.Name]; h.Name != "" && len(js) > 0 {
+			byName[h.Name] = js[1:]
+			next = next.add(h, old.ids[js[0]])
+			next.carry(len(next.ids)-1, old, js[0])
+		} else {
+			next = next.add(h, l.newID())
+			l.resurrect(next, len(next.ids)-1)
+			l.quarantineNew(next)
+		}
+	}
+	for j, id := range old.ids {
+		if _, ok := next.find(id); !ok {
+			l.bury(j)
+			l.affinity.removeIf(func(affine int) bool { return affine == id })
+		}
+	}
+	l.install(next)
+	l.trimTombstones()
+	l.rebalance(old)
+	l.record("set_handlers", "", before)
+}
+
+// Rebalances the weights after handlers came or went, old being the set
+// installed before. Within [Config.RebalanceDebounce] of the last such
+// rebalance the handlers only keep the weights they had, new handlers getting
+// none, and the rebalance is done once at the end of the window. Needs the
+// lock.
+func (l *LoadBalancer[T, U]) rebalance(old *handlerSet[T, U]) {
+	now := time.Now()
+	wait := l.rebalanced.Add(l.RebalanceDebounce).Sub(now)
+	if l.RebalanceDebounce <= 0 || wait <= 0 {
+		l.rebalanced = now
+		l.updateWeights()
+		return
+	}
+
+	weights := make([]int, len(l.ids))
+	for i, id := range l.ids {
+		if j, ok := old.find(id); ok {
+			weights[i] = old.weights[j]
+		}
+	}
+	l.setWeights(weights)
+	if l.rebalancing == nil {
+		l.rebalancing = time.AfterFunc(wait, func() {
+			l.mut.Lock()
+			defer l.mut.Unlock()
+			if l.rebalancing == nil {
+				// Stopped by Destroy
+				return
+			}
+			l.rebalancing = nil
+			l.rebalanced = time.Now()
+			l.updateWeights()
+		})
+	}
+}
+
+// Makes s the set of handlers dispatched to. Needs the lock.
+func (l *LoadBalancer[T, U]) install(s *handlerSet[T, U]) {
+	l.handlerSet = s
+	l.current.Store(s)
+}
+
+// Returns the installed set of handlers, for use without the lock.
+func (l *LoadBalancer[T, U]) handlers() *handlerSet[T, U] {
+	return l.current.Load()
+}
+
+// Returns an identity for a new handler. Needs the lock.
+func (l *LoadBalancer[T, U]) newID() int {
+	l.lastID++
+	return l.lastID
+}
+
+// Returns the index of the handler with the given identity, or false if it was
+// removed.
+func (s *handlerSet[T, U]) find(id int) (int, bool) {
+	i := slices.Index(s.ids, id)
+	return i, i >= 0
+}
+
+// Returns a copy of s with h appended. s is left as is, the slices can be
+// shared since s never reads past its own length.
+func (s *handlerSet[T, U]) add(h Handler[T, U], id int) *handlerSet[T, U] {
+	next := *s
+	i := len(s.dispatch)
+	next.ids = append(next.ids, id)
+	next.dispatch = append(next.dispatch, h.Dispatch)
+	next.schedules = append(next.schedules, h.CapacitySchedule)
+	next.overrides = append(next.overrides, h.Overrides)
+	next.names = append(next.names, h.Name)
+	next.data = append(next.data, h.Data)
+	next.weights = append(next.weights, 0)
+	next.successes = append(next.successes, new(atomic.Int32))
+	next.errors = append(next.errors, new(atomic.Int32))
+	next.rejections = append(next.rejections, new(shard.Counter))
+	next.maxRates = append(next.maxRates, max(h.MaxRate, 0))
+	next.caps = append(next.caps, next.clampCap(i, max(h.EstCap, 1)))
+	next.hints = append(next.hints, max(h.WeightHint, 0))
+	next.penalties = append(next.penalties, 0)
+	var limiter *rate.Limiter
+	if h.MaxRate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(h.MaxRate), 1)
+	}
+	next.limiters = append(next.limiters, limiter)
+	next.pacers = append(next.pacers, rate.NewLimiter(rate.Inf, 1))
+	next.exhaustedUntil = append(next.exhaustedUntil, new(atomic.Int64))
+	lastCompleted := new(atomic.Int64)
+	lastCompleted.Store(time.Now().UnixNano())
+	next.lastCompleted = append(next.lastCompleted, lastCompleted)
+	next.estimators = append(next.estimators, nil)
+	next.latencies = append(next.latencies, new(atomic.Int64))
+	next.inFlight = append(next.inFlight, new(atomic.Int32))
+	next.peakInFlight = append(next.peakInFlight, new(atomic.Int32))
+	next.ewmaLatency = append(next.ewmaLatency, new(atomic.Int64))
+	next.coolDownUntil = append(next.coolDownUntil, new(atomic.Int64))
+	next.deflections = append(next.deflections, new(atomic.Int64))
+	next.explorations = append(next.explorations, new(atomic.Int64))
+	next.exploreErrors = append(next.exploreErrors, new(atomic.Int64))
+	next.traceUntil = append(next.traceUntil, new(atomic.Int64))
+	next.quarantine = append(next.quarantine, nil)
+	return &next
+}
+
+// Gives handler i of s what was learned about handler j of from, and the
+// counters of its calls, keeping its settings. For when handler j is being
+// replaced by handler i.
+func (s *handlerSet[T, U]) carry(i int, from *handlerSet[T, U], j int) {
+	s.weights[i] = from.weights[j]
+	s.successes[i] = from.successes[j]
+	s.errors[i] = from.errors[j]
+	s.rejections[i] = from.rejections[j]
+	s.caps[i] = s.clampCap(i, from.caps[j])
+	s.penalties[i] = from.penalties[j]
+	s.pacers[i] = from.pacers[j]
+	s.exhaustedUntil[i] = from.exhaustedUntil[j]
+	s.lastCompleted[i] = from.lastCompleted[j]
+	s.estimators[i] = from.estimators[j]
+	s.latencies[i] = from.latencies[j]
+	s.inFlight[i] = from.inFlight[j]
+	s.peakInFlight[i] = from.peakInFlight[j]
+	s.ewmaLatency[i] = from.ewmaLatency[j]
+	s.coolDownUntil[i] = from.coolDownUntil[j]
+	s.deflections[i] = from.deflections[j]
+	s.explorations[i] = from.explorations[j]
+	s.exploreErrors[i] = from.exploreErrors[j]
+	s.traceUntil[i] = from.traceUntil[j]
+	s.quarantine[i] = from.quarantine[j]
+}
+
+// Returns a copy of s without handler i. s is left as is.
+func (s *handlerSet[T, U]) remove(i int) *handlerSet[T, U] {
+	return &handlerSet[T, U]{
+		ids:            without(s.ids, i),
+		dispatch:       without(s.dispatch, i),
+		schedules:      without(s.schedules, i),
+		overrides:      without(s.overrides, i),
+		names:          without(s.names, i),
+		data:           without(s.data, i),
+		weights:        without(s.weights, i),
+		successes:      without(s.successes, i),
+		errors:         without(s.errors, i),
+		rejections:     without(s.rejections, i),
+		caps:           without(s.caps, i),
+		maxRates:       without(s.maxRates, i),
+		hints:          without(s.hints, i),
+		penalties:      without(s.penalties, i),
+		limiters:       without(s.limiters, i),
+		pacers:         without(s.pacers, i),
+		exhaustedUntil: without(s.exhaustedUntil, i),
+		lastCompleted:  without(s.lastCompleted, i),
+		estimators:     without(s.estimators, i),
+		latencies:      without(s.latencies, i),
+		inFlight:       without(s.inFlight, i),
+		peakInFlight:   without(s.peakInFlight, i),
+		ewmaLatency:    without(s.ewmaLatency, i),
+		coolDownUntil:  without(s.coolDownUntil, i),
+		deflections:    without(s.deflections, i),
+		explorations:   without(s.explorations, i),
+		exploreErrors:  without(s.exploreErrors, i),
+		traceUntil:     without(s.traceUntil, i),
+		quarantine:     without(s.quarantine, i),
+	}
+}
+
+// Returns a copy of s without element i.
+func without[E any](s []E, i int) []E {
+	return slices.Delete(slices.Clone(s), i, i+1)
+}
+
+// Lines up samples taken from the handlers of from with the handlers of s, for
+// when handlers came or went while they were being taken. Handlers new to s
+// get no sample.
+func (s *handlerSet[T, U]) align(from *handlerSet[T, U], samples []*Sample) []*Sample {
+	if from == s {
+		return samples
+	}
+	aligned := make([]*Sample, len(s.ids))
+	for i, id := range from.ids {
+		if j, ok := s.find(id); ok {
+			aligned[j] = samples[i]
+		}
+	}
+	return aligned
+}
@@ -0,0 +1,298 @@
+package lb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddRemoveHandler(t *testing.T) {
+	handler := func(name string, estCap float64) lb.Handler[int, string] {
+		return lb.Handler[int, string]{
+			Name:   name,
+			EstCap: estCap,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				return name, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler("a", 10), handler("b", 10))
+	balancer.ExplorationRate = 0
+
+	assert.Equal(t, 2, balancer.AddHandler(handler("c", 20)))
+	assert.Equal(t, []float64{10, 10, 20}, balancer.GetCapacities())
+	assert.Equal(t, []int{25, 25, 50}, balancer.GetWeights())
+
+	balancer.RemoveHandler(0)
+	assert.Equal(t, []float64{10, 20}, balancer.GetCapacities())
+	assert.Equal(t, []int{33, 67}, balancer.GetWeights())
+
+	served := map[string]int{}
+	for i := range 100 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		served[res]++
+	}
+	assert.Equal(t, map[string]int{"b": 33, "c": 67}, served)
+
+	var names []string
+	for _, stats := range balancer.GetStats() {
+		names = append(names, stats.Name)
+	}
+	assert.Equal(t, []string{"b", "c"}, names)
+
+	balancer.RemoveHandler(1)
+	balancer.RemoveHandler(0)
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrNoHandlers)
+
+	actions := []string{}
+	for _, event := range balancer.AuditLog() {
+		actions = append(actions, event.Action)
+	}
+	assert.Equal(t, []string{"add_handler", "remove_handler", "remove_handler", "remove_handler"}, actions)
+}
+
+func TestSetHandlers(t *testing.T) {
+	handler := func(name, value string, estCap float64) lb.Handler[int, string] {
+		return lb.Handler[int, string]{
+			Name:   name,
+			EstCap: estCap,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				return value, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler("a", "a", 10), handler("b", "b", 10))
+	balancer.ExplorationRate = 0
+	balancer.SetAllCapacities([]float64{30, 10})
+
+	// a keeps what was learned about it but gets its new settings, b goes
+	// and c is new
+	balancer.SetHandlers([]lb.Handler[int, string]{
+		handler("c", "c", 10),
+		handler("a", "a2", 1),
+	})
+	assert.Equal(t, []float64{10, 30}, balancer.GetCapacities())
+	assert.Equal(t, []int{25, 75}, balancer.GetWeights())
+
+	served := map[string]int{}
+	for i := range 100 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		served[res]++
+	}
+	assert.Equal(t, map[string]int{"c": 25, "a2": 75}, served)
+
+	var names []string
+	for _, stats := range balancer.GetStats() {
+		names = append(names, stats.Name)
+	}
+	assert.Equal(t, []string{"c", "a"}, names)
+	assert.Equal(t, "set_handlers", balancer.AuditLog()[1].Action)
+
+	balancer.SetHandlers(nil)
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrNoHandlers)
+}
+
+// Tests that handlers can come and go while dispatches and ticks are running.
+// Mostly useful with -race.
+func TestAddRemoveHandlerConcurrently(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 100,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			time.Sleep(time.Millisecond)
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler)
+	balancer.UpdateInterval = time.Millisecond
+	balancer.Start()
+	defer balancer.Destroy()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				balancer.Dispatch(ctx, 1)
+			}
+		}()
+	}
+
+	for range 20 {
+		balancer.AddHandler(handler)
+		balancer.GetStats()
+		balancer.RemoveHandler(0)
+	}
+	cancel()
+	wg.Wait()
+
+	assert.Len(t, balancer.GetWeights(), 1)
+	res, err := balancer.Dispatch(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res)
+}
+
+func TestAddRemoveHandlerWeightFunc(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler, handler)
+	var got [][]int
+	balancer.WeightFunc = func(caps []float64, stats []lb.HandlerStats) []int {
+		weights := make([]int, len(stats))
+		for i, s := range stats {
+			weights[i] = s.Weight
+		}
+		got = append(got, weights)
+		return lb.Softmax(1, 100)(caps, stats)
+	}
+
+	balancer.AddHandler(lb.Handler[int, int]{EstCap: 40, Dispatch: handler.Dispatch})
+	assert.Equal(t, []int{50, 50, 0}, got[len(got)-1])
+	weights := balancer.GetWeights()
+	assert.Len(t, weights, 3)
+
+	// The stats passed along stay with their handler
+	balancer.RemoveHandler(0)
+	assert.Equal(t, weights[1:], got[len(got)-1])
+	assert.Len(t, balancer.GetWeights(), 2)
+}
+
+// Tests that slow calls don't hold up handlers coming and going, nor the
+// dispatches after them.
+func TestAddRemoveHandlerWhileCalling(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	balancer := lb.NewLoadBalancer(lb.Handler[int, string]{
+		Name:   "slow",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (string, error) {
+			close(started)
+			<-gate
+			return "slow", nil
+		},
+	})
+
+	slow := make(chan string)
+	go func() {
+		res, err := balancer.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		slow <- res
+	}()
+	<-started
+
+	balancer.AddHandler(lb.Handler[int, string]{
+		Name:   "fast",
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (string, error) {
+			return "fast", nil
+		},
+	})
+	balancer.RemoveHandler(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	res, err := balancer.Dispatch(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", res)
+
+	// The removed handler still finishes its call
+	close(gate)
+	assert.Equal(t, "slow", <-slow)
+}
+
+// Tests that a scatter keeps calling the handlers it started with.
+func TestScatterWhileRemoving(t *testing.T) {
+	gate := make(chan struct{})
+	var started sync.WaitGroup
+	shard := func(name string) lb.Handler[int, string] {
+		started.Add(1)
+		return lb.Handler[int, string]{
+			Name:   name,
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				started.Done()
+				<-gate
+				return name, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(shard("a"), shard("b"), shard("c"))
+
+	results := balancer.Scatter(context.Background(), 1)
+	started.Wait()
+	balancer.RemoveHandler(0)
+	close(gate)
+
+	got := map[int]string{}
+	for res := range results {
+		assert.NoError(t, res.Err)
+		assert.Equal(t, res.Name, res.Value)
+		got[res.Index] = res.Value
+	}
+	assert.Equal(t, map[int]string{0: "a", 1: "b", 2: "c"}, got)
+}
+
+// Tests that a burst of handlers coming and going is rebalanced once.
+func TestRebalanceDebounce(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler)
+	balancer.RebalanceDebounce = 50 * time.Millisecond
+
+	balancer.AddHandler(handler)
+	assert.Equal(t, []int{50, 50}, balancer.GetWeights())
+
+	// Held back, the weights are only carried over
+	balancer.AddHandler(handler)
+	balancer.AddHandler(handler)
+	balancer.RemoveHandler(0)
+	assert.Equal(t, []int{50, 0, 0}, balancer.GetWeights())
+
+	assert.Eventually(t, func() bool {
+		weights := balancer.GetWeights()
+		return weights[1] > 0 && weights[2] > 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []int{34, 33, 33}, balancer.GetWeights())
+}
+
+// Tests that a rebalance held back still updates the total capacity, and that
+// destroying the load balancer drops it.
+func TestRebalanceDebounceDestroy(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler)
+	balancer.RebalanceDebounce = 50 * time.Millisecond
+
+	balancer.AddHandler(handler)
+	balancer.AddHandler(handler)
+	assert.Equal(t, []int{50, 50, 0}, balancer.GetWeights())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.NoError(t, balancer.AwaitReady(ctx, 30))
+
+	balancer.Destroy()
+	assert.Never(t, func() bool {
+		return balancer.GetWeights()[2] > 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,51 @@
+package lb
+
+import (
+	"context"
+	"time"
+)
+
+// Feeds the result of a call to handler index that was routed by something
+// else into the estimates, for running the load balancer in observed mode:
+// learning capacities and weights from existing traffic without routing it,
+// e.g. to see how the estimates hold up before trusting them with the
+// routing. The handlers then need no [Handler.Dispatch]. Ticks turn the
+// results into capacities and weights as usual, read them with
+// [LoadBalancer.Current] or [LoadBalancer.GetStats].
+//
+// err is what the call returned and counts as it would from a dispatch:
+// [ErrExceedCap] as a rejection, [ErrQuotaExhausted] takes the handler out of
+// rotation, and errors caused by ctx being done are ignored. The calls running
+// at once aren't known, so estimators that go by them, e.g. [NewLittlesLaw],
+// need a fixed concurrency. Panics if there is no handler at index.
+func (l *LoadBalancer[T, U]) RecordResult(ctx context.Context, index int, err error, latency time.Duration) {
+	s := l.handlers()
+	now := time.Now()
+	outcome := outcomeOf(err)
+	if cancelled(ctx, err) {
+		outcome = OutcomeCancelled
+	}
+
+	switch outcome {
+	case OutcomeRejected:
+		s.rejections[index].Add(1)
+	case OutcomeExhausted:
+		l.exhaust(s, index, err)
+	case OutcomeSuccess:
+		s.successes[index].Add(1)
+	case OutcomeError:
+		s.errors[index].Add(1)
+	}
+	if outcome == OutcomeSuccess || outcome == OutcomeError {
+		s.latencies[index].Add(int64(latency))
+		s.observeLatency(index, l.LatencySmoothingFactor, latency)
+		s.lastCompleted[index].Store(now.UnixNano())
+	}
+	l.recordAttempt(Record{
+		Time:    now.Add(-latency),
+		Handler: index,
+		ID:      s.ids[index],
+		Outcome: outcome,
+		Latency: latency,
+	})
+}
@@ -0,0 +1,50 @@
+package lb_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests learning from calls routed elsewhere.
+func TestRecordResult(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 10},
+		lb.Handler[int, int]{Name: "b", EstCap: 10},
+	)
+	balancer.UpdateInterval = 100 * time.Millisecond
+	var buf bytes.Buffer
+	balancer.Recorder = lb.NewRecorder(&buf)
+
+	ctx := context.Background()
+	for range 3 {
+		for range 10 {
+			balancer.RecordResult(ctx, 0, nil, 10*time.Millisecond)
+		}
+		balancer.RecordResult(ctx, 1, lb.ErrExceedCap, time.Millisecond)
+		balancer.TickOnce()
+	}
+	weights := balancer.GetWeights()
+	assert.Greater(t, weights[0], weights[1])
+	assert.Equal(t, 10*time.Millisecond, balancer.GetStats()[0].Latency)
+
+	// Cancelled calls say nothing about the handler
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	balancer.RecordResult(cancelled, 1, context.Canceled, time.Second)
+	assert.Zero(t, balancer.GetStats()[1].Latency)
+
+	balancer.RecordResult(ctx, 1, fmt.Errorf("daily limit: %w", lb.ErrQuotaExhausted), 0)
+	assert.Equal(t, 0, balancer.GetWeights()[1])
+
+	// Results are recorded like dispatches
+	assert.NoError(t, balancer.Recorder.Flush())
+	records, err := lb.ReadRecords(&buf)
+	assert.NoError(t, err)
+	assert.Len(t, records, 35)
+}
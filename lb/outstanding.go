@@ -0,0 +1,52 @@
+package lb
+
+// Returns a [Strategy] that sends each call to the handler with the fewest
+// calls running, which beats the round robin for handlers whose latency varies
+// a lot since a handler stuck on slow calls gets no more until it catches up.
+// With byCapacity, calls running are counted relative to each handler's
+// weight, so a handler learned to take twice the load gets twice the calls at
+// once. Handlers without weight, e.g. those out of quota, are only used if
+// there is nothing else. Ties go to the handler after the last one chosen.
+func LeastOutstanding(byCapacity bool) Strategy {
+	return &leastOutstanding{byCapacity: byCapacity}
+}
+
+type leastOutstanding struct {
+	byCapacity bool
+	weights    []int
+	inFlight   func(index int) int
+	last       int // the last handler chosen
+}
+
+func (s *leastOutstanding) SetWeights(weights []int) {
+	s.weights = weights
+}
+
+func (s *leastOutstanding) SetInFlight(inFlight func(index int) int) {
+	s.inFlight = inFlight
+}
+
+func (s *leastOutstanding) Next(usable func(index int) bool) (int, bool) {
+	n := len(s.weights)
+	best, bestLoad := -1, 0.0
+	for k := range n {
+		i := (s.last + 1 + k) % n
+		if s.weights[i] <= 0 || !usable(i) {
+			continue
+		}
+		load := float64(s.inFlight(i))
+		if s.byCapacity {
+			// Counting the call about to be made breaks ties between
+			// idle handlers by weight
+			load = (load + 1) / float64(s.weights[i])
+		}
+		if best < 0 || load < bestLoad {
+			best, bestLoad = i, load
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	s.last = best
+	return best, true
+}
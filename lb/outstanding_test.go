@@ -0,0 +1,69 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeastOutstanding(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 1)
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, string]{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				return "fast", nil
+			},
+		},
+		lb.Handler[int, string]{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				started <- struct{}{}
+				<-gate
+				return "slow", nil
+			},
+		},
+	)
+	balancer.ExplorationRate = 0
+	balancer.SetStrategy(lb.LeastOutstanding(false))
+
+	slow := make(chan string)
+	go func() {
+		res, _ := balancer.Dispatch(context.Background(), 0)
+		slow <- res
+	}()
+	<-started
+
+	// Everything goes around the handler that is stuck
+	for i := range 5 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		assert.Equal(t, "fast", res)
+	}
+	close(gate)
+	assert.Equal(t, "slow", <-slow)
+}
+
+func TestLeastOutstandingByCapacity(t *testing.T) {
+	var chosen []int
+	handler := func(ctx context.Context, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		chosen = append(chosen, info.Index)
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 30, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	balancer.SetStrategy(lb.LeastOutstanding(true))
+
+	// Idle handlers are told apart by capacity
+	for i := range 3 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Equal(t, []int{1, 1, 1}, chosen)
+}
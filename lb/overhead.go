@@ -0,0 +1,57 @@
+package lb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// What the load balancer itself costs, as opposed to the handlers it calls.
+// Times are totals since it was created.
+type Overhead struct {
+	// Number of times a handler was chosen, or the choice failed
+	Selections int64 `json:"selections"`
+	// Time spent selecting handlers, including waiting for the lock
+	SelectionTime time.Duration `json:"selection_time"`
+	// Time spent waiting for the lock while selecting handlers and updating
+	// the weights
+	LockWait time.Duration `json:"lock_wait"`
+	// Number of update cycles run
+	Ticks int64 `json:"ticks"`
+	// Time spent in update cycles
+	TickTime time.Duration `json:"tick_time"`
+	// How long the last update cycle took
+	LastTick time.Duration `json:"last_tick"`
+	// Dispatches sleeping in a backoff right now
+	BackingOff int `json:"backing_off"`
+}
+
+type overhead struct {
+	selections    atomic.Int64
+	selectionTime atomic.Int64 // nanos
+	lockWait      atomic.Int64 // nanos
+	ticks         atomic.Int64
+	tickTime      atomic.Int64 // nanos
+	lastTick      atomic.Int64 // nanos
+	backingOff    atomic.Int32
+}
+
+// Takes the lock, accounting for the time spent waiting for it.
+func (l *LoadBalancer[T, U]) lock() {
+	start := time.Now()
+	l.mut.Lock()
+	l.overhead.lockWait.Add(int64(time.Since(start)))
+}
+
+// Returns what the load balancer itself has cost so far.
+func (l *LoadBalancer[T, U]) GetOverhead() Overhead {
+	o := &l.overhead
+	return Overhead{
+		Selections:    o.selections.Load(),
+		SelectionTime: time.Duration(o.selectionTime.Load()),
+		LockWait:      time.Duration(o.lockWait.Load()),
+		Ticks:         o.ticks.Load(),
+		TickTime:      time.Duration(o.tickTime.Load()),
+		LastTick:      time.Duration(o.lastTick.Load()),
+		BackingOff:    int(o.backingOff.Load()),
+	}
+}
@@ -0,0 +1,51 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverhead(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(handler, handler)
+	assert.Equal(t, lb.Overhead{}, balancer.GetOverhead())
+
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	balancer.TickOnce()
+
+	overhead := balancer.GetOverhead()
+	assert.Equal(t, int64(10), overhead.Selections)
+	assert.Positive(t, overhead.SelectionTime)
+	assert.Equal(t, int64(1), overhead.Ticks)
+	assert.Positive(t, overhead.LastTick)
+	assert.Equal(t, overhead.LastTick, overhead.TickTime)
+	assert.Zero(t, overhead.BackingOff)
+}
+
+func TestOverheadBackingOff(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, lb.ErrExceedCap
+		},
+	})
+	balancer.BackoffUnit = time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go balancer.Dispatch(ctx, 1)
+	assert.Eventually(t, func() bool {
+		return balancer.GetOverhead().BackingOff == 1
+	}, time.Second, time.Millisecond)
+}
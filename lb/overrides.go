@@ -0,0 +1,31 @@
+package lb
+
+import "time"
+
+// Settings of a single handler that take precedence over [Config], e.g. for a
+// fast churning serverless backend among stable VMs. Fields left at their zero
+// value fall back to the config.
+type HandlerOverrides struct {
+	// Overrides [Config.SmoothingFactor] in this handler's estimator
+	SmoothingFactor float64
+	// Ceiling on how long calls back off for after this handler rejects
+	// them, and so on how long it is avoided for with [Config.Deflect]. It
+	// replaces the ceiling set by [Config.BackoffMaxExponent], so it can be
+	// longer too, e.g. minutes for a quota API among internal services that
+	// recover within seconds.
+	MaxBackoff time.Duration
+}
+
+// Returns the config as seen by handler i, with its overrides applied. Needs
+// the lock.
+func (l *LoadBalancer[T, U]) configFor(i int) *Config {
+	o := l.overrides[i]
+	if o == (HandlerOverrides{}) {
+		return &l.Config
+	}
+	c := l.Config
+	if o.SmoothingFactor > 0 {
+		c.SmoothingFactor = o.SmoothingFactor
+	}
+	return &c
+}
@@ -0,0 +1,66 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSmoothingFactorOverride(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	fast := handler
+	fast.Overrides.SmoothingFactor = 0.9
+	balancer := lb.NewLoadBalancer(handler, fast)
+	balancer.SmoothingFactor = 0.1
+	balancer.ExplorationRate = 0
+	balancer.SetAllCapacities([]float64{100, 100})
+
+	// Both see the same traffic, the overridden one follows it more closely
+	for range 3 {
+		for i := range 10 {
+			balancer.Dispatch(context.Background(), i)
+		}
+		balancer.TickOnce()
+	}
+	caps := balancer.GetCapacities()
+	assert.Less(t, caps[1], caps[0])
+}
+
+func TestMaxBackoffOverride(t *testing.T) {
+	attempts := func(maxBackoff time.Duration) int {
+		handler := lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				return 0, lb.ErrExceedCap
+			},
+			Overrides: lb.HandlerOverrides{MaxBackoff: maxBackoff},
+		}
+		balancer := lb.NewLoadBalancer(handler)
+		balancer.BackoffUnit = 10 * time.Millisecond
+
+		var count int
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		balancer.DispatchWithOpts(ctx, 1, lb.DispatchOpts{
+			OnAttempt: func(attempt int, index int) error {
+				count++
+				return nil
+			},
+		})
+		return count
+	}
+
+	// Backing off 10, 20, 40, 80 and 160ms uses up the time by the 5th
+	// attempt, while never backing off for longer than 20ms leaves time for
+	// many more.
+	assert.LessOrEqual(t, attempts(0), 6)
+	assert.GreaterOrEqual(t, attempts(20*time.Millisecond), 10)
+}
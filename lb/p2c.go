@@ -0,0 +1,60 @@
+package lb
+
+import "math/rand"
+
+// Returns a [Strategy] that picks two handlers at random and sends each call to
+// the less loaded of them, going by the calls running on each relative to its
+// weight. Unlike always picking the least loaded handler, see
+// [LeastOutstanding], callers racing each other spread out instead of all
+// piling onto the same handler, which keeps the tail latency down at high
+// concurrency. Handlers without weight, e.g. those out of quota, are only used
+// if there is nothing else.
+func PowerOfTwoChoices() Strategy {
+	return &powerOfTwo{}
+}
+
+type powerOfTwo struct {
+	weights    []int
+	inFlight   func(index int) int
+	candidates []int // reused between calls to Next
+}
+
+func (s *powerOfTwo) SetWeights(weights []int) {
+	s.weights = weights
+}
+
+func (s *powerOfTwo) SetInFlight(inFlight func(index int) int) {
+	s.inFlight = inFlight
+}
+
+func (s *powerOfTwo) Next(usable func(index int) bool) (int, bool) {
+	s.candidates = s.candidates[:0]
+	for i, w := range s.weights {
+		if w > 0 && usable(i) {
+			s.candidates = append(s.candidates, i)
+		}
+	}
+	switch len(s.candidates) {
+	case 0:
+		return 0, false
+	case 1:
+		return s.candidates[0], true
+	}
+
+	k := rand.Intn(len(s.candidates))
+	j := rand.Intn(len(s.candidates) - 1)
+	if j >= k {
+		j++
+	}
+	a, b := s.candidates[k], s.candidates[j]
+	if s.load(b) < s.load(a) {
+		return b, true
+	}
+	return a, true
+}
+
+// Calls running on handler i relative to its weight, counting the call about
+// to be made so idle handlers are told apart by weight.
+func (s *powerOfTwo) load(i int) float64 {
+	return float64(s.inFlight(i)+1) / float64(s.weights[i])
+}
@@ -0,0 +1,76 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowerOfTwoChoices(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 1)
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, string]{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				started <- struct{}{}
+				<-gate
+				return "slow", nil
+			},
+		},
+		lb.Handler[int, string]{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (string, error) {
+				return "fast", nil
+			},
+		},
+	)
+	balancer.ExplorationRate = 0
+	balancer.SetStrategy(lb.PowerOfTwoChoices())
+
+	// Keep calling until one gets stuck on the slow handler
+	slow := make(chan string)
+	go func() {
+		for {
+			res, _ := balancer.Dispatch(context.Background(), 0)
+			if res == "slow" {
+				slow <- res
+				return
+			}
+		}
+	}()
+	<-started
+
+	// With only two to choose from, everything goes around it
+	for i := range 5 {
+		res, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+		assert.Equal(t, "fast", res)
+	}
+	close(gate)
+	assert.Equal(t, "slow", <-slow)
+}
+
+func TestPowerOfTwoChoicesByWeight(t *testing.T) {
+	counts := make([]int, 3)
+	handler := func(ctx context.Context, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		counts[info.Index]++
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 30, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	balancer.SetStrategy(lb.PowerOfTwoChoices())
+
+	// Idle, the heavier handler wins every pair it is in
+	for i := range 300 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.InDelta(t, 200, counts[2], 40)
+}
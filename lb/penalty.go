@@ -0,0 +1,18 @@
+package lb
+
+import "math"
+
+// Decays the error penalty of handler i by one tick, then raises it to the
+// share of failed calls in the sample if that is higher. Needs the lock.
+func (l *LoadBalancer[T, U]) updatePenalty(i int, sample *Sample) {
+	if l.ErrorPenaltyHalfLife <= 0 {
+		l.penalties[i] = 0
+		return
+	}
+
+	halvings := float64(l.UpdateInterval) / float64(l.ErrorPenaltyHalfLife)
+	l.penalties[i] *= math.Pow(0.5, halvings)
+	if sample != nil && sample.Calls > 0 {
+		l.penalties[i] = max(l.penalties[i], min(sample.Errors/sample.Calls, 1))
+	}
+}
@@ -0,0 +1,60 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorPenaltyDecays(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1000, 1000)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.ExplorationRate = 0
+	balancer.ErrorPenaltyHalfLife = time.Second
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		if index == 1 {
+			return 0, errors.New("broken")
+		}
+		return param, nil
+	}
+
+	for i := range 20 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	balancer.TickOnce()
+	stats := balancer.GetStats()
+	assert.Equal(t, 0.0, stats[0].Penalty)
+	assert.Equal(t, 1.0, stats[1].Penalty)
+	assert.Equal(t, 0, stats[1].Weight)
+
+	// Halves every tick without any traffic
+	balancer.TickOnce()
+	assert.Equal(t, 0.5, balancer.GetStats()[1].Penalty)
+
+	assert.NoError(t, balancer.SetAllCapacities([]float64{50, 50}))
+	assert.Equal(t, []int{67, 33}, balancer.GetWeights())
+
+	balancer.TickOnce()
+	assert.Equal(t, 0.25, balancer.GetStats()[1].Penalty)
+}
+
+func TestErrorPenaltyDisabled(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1000, 1000)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		return 0, errors.New("broken")
+	}
+
+	for i := range 20 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	balancer.TickOnce()
+	for _, s := range balancer.GetStats() {
+		assert.Equal(t, 0.0, s.Penalty)
+	}
+}
@@ -0,0 +1,59 @@
+package lb
+
+import "time"
+
+// These presets are starting points for common kinds of downstreams. Start from
+// whichever is closest to yours and adjust from there, e.g.
+//
+//	l := lb.NewLoadBalancer(handlers...)
+//	l.Config = lb.PresetQuotaAPI()
+//
+// The knobs interact: the backoff settings decide how quickly a rejecting
+// handler is retried, the AIMD settings decide how hard each rejection or
+// success moves its capacity, and the smoothing factor and update interval
+// decide how fast the estimate follows what was actually observed.
+
+// For third party APIs with a fixed quota that reply with [ErrExceedCap] when
+// you go over. Rejections are expensive and quotas rarely change, so back off
+// for long, cut capacity hard on rejections, grow it back slowly and explore
+// little.
+func PresetQuotaAPI() Config {
+	c := DefaultConfig()
+	c.BackoffUnit = 500 * time.Millisecond
+	c.BackoffMaxExponent = 8
+	c.UpdateInterval = 5 * time.Second
+	c.SmoothingFactor = 0.3
+	c.ExplorationRate = 0.05
+	c.AIMDIncrease = 0.05
+	c.AIMDDecreaseFactor = 0.5
+	return c
+}
+
+// For services you own that respond quickly and whose capacity shifts with
+// autoscaling and deploys. Retry soon, and follow observed rates quickly.
+func PresetInternalRPC() Config {
+	c := DefaultConfig()
+	c.BackoffUnit = 10 * time.Millisecond
+	c.BackoffMaxExponent = 6
+	c.UpdateInterval = time.Second
+	c.SmoothingFactor = 0.6
+	c.ExplorationRate = 0.1
+	c.AIMDIncrease = 0.5
+	c.AIMDDecreaseFactor = 0.9
+	return c
+}
+
+// For pools of workers running long jobs, where throughput matters more than
+// latency and per second counts are noisy. Use long update intervals and heavy
+// smoothing so the weights stay steady.
+func PresetBatchWorkers() Config {
+	c := DefaultConfig()
+	c.BackoffUnit = time.Second
+	c.BackoffMaxExponent = 5
+	c.UpdateInterval = 10 * time.Second
+	c.SmoothingFactor = 0.2
+	c.ExplorationRate = 0.02
+	c.AIMDIncrease = 0.1
+	c.AIMDDecreaseFactor = 0.8
+	return c
+}
@@ -0,0 +1,78 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that every preset is a usable config.
+func TestPresetsValid(t *testing.T) {
+	presets := map[string]lb.Config{
+		"QuotaAPI":     lb.PresetQuotaAPI(),
+		"InternalRPC":  lb.PresetInternalRPC(),
+		"BatchWorkers": lb.PresetBatchWorkers(),
+	}
+	for name, config := range presets {
+		t.Run(name, func(t *testing.T) {
+			assert.Positive(t, config.BackoffUnit)
+			assert.Positive(t, config.BackoffMaxExponent)
+			assert.Positive(t, config.UpdateInterval)
+			assert.Positive(t, config.SmoothingFactor)
+			assert.LessOrEqual(t, config.SmoothingFactor, 1.0)
+			assert.Positive(t, config.ExplorationRate)
+			assert.Less(t, config.ExplorationRate, 1.0)
+			assert.Positive(t, config.AIMDIncrease)
+			assert.Positive(t, config.AIMDDecreaseFactor)
+			assert.Less(t, config.AIMDDecreaseFactor, 1.0)
+			// Everything else is left at the defaults
+			defaults := lb.DefaultConfig()
+			assert.Equal(t, defaults.WeightScale, config.WeightScale)
+			assert.Equal(t, defaults.MaxRounds, config.MaxRounds)
+
+			handler := lb.Handler[int, int]{
+				EstCap: 10,
+				Dispatch: func(ctx context.Context, param int) (int, error) {
+					return param, nil
+				},
+			}
+			balancer := lb.NewLoadBalancer(handler, handler)
+			balancer.Config = config
+			res, err := balancer.Dispatch(context.Background(), 1)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, res)
+			balancer.TickOnce()
+			assert.Equal(t, 100, balancer.GetWeights()[0]+balancer.GetWeights()[1])
+		})
+	}
+}
+
+// Tests that the presets differ the way they are documented to.
+func TestPresetsDiffer(t *testing.T) {
+	quota := lb.PresetQuotaAPI()
+	rpc := lb.PresetInternalRPC()
+	batch := lb.PresetBatchWorkers()
+
+	// Quota APIs back off for long, cut hard, grow back slowly and explore
+	// little
+	assert.Greater(t, quota.BackoffUnit, rpc.BackoffUnit)
+	assert.Less(t, quota.AIMDDecreaseFactor, rpc.AIMDDecreaseFactor)
+	assert.Less(t, quota.AIMDDecreaseFactor, batch.AIMDDecreaseFactor)
+	assert.Less(t, quota.AIMDIncrease, rpc.AIMDIncrease)
+	assert.Less(t, quota.ExplorationRate, rpc.ExplorationRate)
+
+	// Internal services are retried soon and followed quickly
+	assert.Less(t, rpc.BackoffUnit, quota.BackoffUnit)
+	assert.Less(t, rpc.BackoffUnit, batch.BackoffUnit)
+	assert.Greater(t, rpc.SmoothingFactor, quota.SmoothingFactor)
+	assert.Greater(t, rpc.SmoothingFactor, batch.SmoothingFactor)
+	assert.Less(t, rpc.UpdateInterval, quota.UpdateInterval)
+
+	// Batch workers update slowly with heavy smoothing
+	assert.Greater(t, batch.UpdateInterval, quota.UpdateInterval)
+	assert.Greater(t, batch.UpdateInterval, rpc.UpdateInterval)
+	assert.Less(t, batch.SmoothingFactor, quota.SmoothingFactor)
+	assert.Less(t, batch.SmoothingFactor, rpc.SmoothingFactor)
+}
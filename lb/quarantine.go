@@ -0,0 +1,58 @@
+package lb
+
+import "time"
+
+// Exploratory calls a quarantined handler had completed when its current trial
+// started, see [Config.QuarantineCalls].
+type probation struct {
+	calls  int64
+	errors int64
+}
+
+// Quarantines the last handler of s, which was just added, if
+// [Config.QuarantineCalls] is set.
+func (l *LoadBalancer[T, U]) quarantineNew(s *handlerSet[T, U]) {
+	if l.QuarantineCalls > 0 {
+		s.quarantine[len(s.quarantine)-1] = &probation{}
+	}
+}
+
+// Whether handler i only gets exploratory calls.
+func (s *handlerSet[T, U]) quarantined(i int) bool {
+	return s.quarantine[i] != nil
+}
+
+// Whether the quarantined handlers of s are held back, which they are as long
+// as there is a handler that isn't quarantined or out of quota to take the
+// traffic instead. Otherwise they are all there is, and they are used as if
+// they weren't quarantined rather than failing every call.
+func (s *handlerSet[T, U]) holdQuarantined(now time.Time) bool {
+	for i, p := range s.quarantine {
+		if p == nil && !s.exhausted(i, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lets quarantined handlers that completed [Config.QuarantineCalls] exploratory
+// calls with at least [Config.QuarantineSuccessRate] of them succeeding out of
+// quarantine. Those that didn't make it start a new trial. Needs the lock.
+func (l *LoadBalancer[T, U]) endQuarantines() {
+	for i, p := range l.quarantine {
+		if p == nil {
+			continue
+		}
+		now := probation{calls: l.explorations[i].Load(), errors: l.exploreErrors[i].Load()}
+		calls := now.calls - p.calls
+		if calls < int64(l.QuarantineCalls) {
+			continue
+		}
+		succeeded := calls - (now.errors - p.errors)
+		if float64(succeeded) >= l.QuarantineSuccessRate*float64(calls) {
+			l.quarantine[i] = nil
+		} else {
+			l.quarantine[i] = &now
+		}
+	}
+}
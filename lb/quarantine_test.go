@@ -0,0 +1,92 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuarantine(t *testing.T) {
+	var unexplored atomic.Int32
+	handler := func(err error) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				if info, _ := lb.DispatchInfoFromContext(ctx); !info.Explore {
+					unexplored.Add(1)
+				}
+				return param, err
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.ExplorationRate = 0.5
+	balancer.QuarantineCalls = 5
+	balancer.QuarantineSuccessRate = 1
+
+	balancer.AddHandler(handler(nil))
+	balancer.AddHandler(handler(errors.New("unproven")))
+	quarantined := func() []bool {
+		var res []bool
+		for _, stats := range balancer.GetStats() {
+			res = append(res, stats.Quarantined)
+		}
+		return res
+	}
+	assert.Equal(t, []bool{false, true, true}, quarantined())
+	assert.Equal(t, []int{100, 0, 0}, balancer.GetWeights())
+
+	for i := range 200 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	// Only probes reached the new handlers
+	assert.Zero(t, unexplored.Load())
+
+	// The one that succeeded gets real traffic, the one that failed starts
+	// over
+	balancer.TickOnce()
+	assert.Equal(t, []bool{false, false, true}, quarantined())
+	weights := balancer.GetWeights()
+	assert.Positive(t, weights[1])
+	assert.Zero(t, weights[2])
+}
+
+// Tests that replacing every handler at once doesn't leave nothing to dispatch
+// to.
+func TestQuarantineEveryHandler(t *testing.T) {
+	handler := func(name string) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			Name:   name,
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				return param, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler("a"), handler("b"))
+	balancer.QuarantineCalls = 5
+	balancer.QuarantineSuccessRate = 1
+
+	balancer.SetHandlers([]lb.Handler[int, int]{handler("c"), handler("d")})
+	assert.Equal(t, []int{50, 50}, balancer.GetWeights())
+	assert.True(t, balancer.Healthy())
+	for i := range 100 {
+		_, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+	}
+
+	// Same with a single handler
+	balancer.SetHandlers([]lb.Handler[int, int]{handler("e")})
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, balancer.GetStats()[0].Quarantined)
+}
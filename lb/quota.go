@@ -0,0 +1,68 @@
+package lb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Return this error (or a [QuotaExhaustedError]) to signal that the handler has
+// used up its quota and should not be called again for a while, e.g. a daily
+// API quota. Unlike [ErrExceedCap] this doesn't lower the handler's estimated
+// capacity, the handler is simply taken out of rotation until its quota resets
+// and the call is retried on another handler. If every handler is out of quota,
+// [LoadBalancer.Dispatch] returns this error.
+var ErrQuotaExhausted = errors.New("lb quota exhausted")
+
+// An [ErrQuotaExhausted] that also says when the quota resets.
+type QuotaExhaustedError struct {
+	Reset time.Time
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrQuotaExhausted, e.Reset.Format(time.RFC3339))
+}
+
+func (e *QuotaExhaustedError) Is(target error) bool {
+	return target == ErrQuotaExhausted
+}
+
+// Whether handler i is currently out of quota.
+func (s *handlerSet[T, U]) exhausted(i int, now time.Time) bool {
+	return now.UnixNano() < s.exhaustedUntil[i].Load()
+}
+
+// Returns why no handler of s could take a call at now: a
+// [QuotaExhaustedError] with the earliest time one of those out of quota gets
+// it back, or [ErrUnavailable] if none of them is out of quota.
+func (s *handlerSet[T, U]) quotaError(now time.Time) error {
+	var reset time.Time
+	for i := range s.exhaustedUntil {
+		if !s.exhausted(i, now) {
+			continue
+		}
+		until := time.Unix(0, s.exhaustedUntil[i].Load())
+		if reset.IsZero() || until.Before(reset) {
+			reset = until
+		}
+	}
+	if reset.IsZero() {
+		return ErrUnavailable
+	}
+	return &QuotaExhaustedError{Reset: reset}
+}
+
+// Takes handler i of s out of rotation until the reset time given by err, or
+// [Config.QuotaResetAfter] from now if there isn't one.
+func (l *LoadBalancer[T, U]) exhaust(s *handlerSet[T, U], i int, err error) {
+	reset := l.now().Add(l.QuotaResetAfter)
+	var quotaErr *QuotaExhaustedError
+	if errors.As(err, &quotaErr) && !quotaErr.Reset.IsZero() {
+		reset = quotaErr.Reset
+	}
+	s.exhaustedUntil[i].Store(reset.UnixNano())
+
+	l.mut.Lock()
+	l.updateWeights()
+	l.mut.Unlock()
+}
@@ -0,0 +1,119 @@
+package lb_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tests that a handler that runs out of quota is skipped until its reset time,
+// without losing its estimated capacity.
+func TestQuotaExhausted(t *testing.T) {
+	var quotaCalls, otherCalls atomic.Int32
+	reset := time.Now().Add(200 * time.Millisecond)
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{
+			EstCap: 5,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				quotaCalls.Add(1)
+				if time.Now().Before(reset) {
+					return 0, &lb.QuotaExhaustedError{Reset: reset}
+				}
+				return 0, nil
+			},
+		},
+		lb.Handler[int, int]{
+			EstCap: 5,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				otherCalls.Add(1)
+				return 1, nil
+			},
+		},
+	)
+	balancer.ExplorationRate = 0
+
+	for range 10 {
+		res, err := balancer.Dispatch(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, res)
+	}
+	assert.Equal(t, int32(1), quotaCalls.Load())
+	assert.Equal(t, int32(10), otherCalls.Load())
+	assert.Equal(t, []int{0, 100}, balancer.GetWeights())
+	assert.Equal(t, []float64{5, 5}, balancer.GetCapacities())
+
+	time.Sleep(250 * time.Millisecond)
+	balancer.SetAllCapacities([]float64{5, 5})
+	for range 10 {
+		balancer.Dispatch(context.Background(), 1)
+	}
+	assert.Equal(t, int32(6), quotaCalls.Load())
+}
+
+func TestAllQuotaExhausted(t *testing.T) {
+	handler := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, lb.ErrQuotaExhausted
+		},
+	}
+
+	balancer := lb.NewLoadBalancer(handler, handler)
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrQuotaExhausted)
+	// Says when the first handler comes back
+	var quotaErr *lb.QuotaExhaustedError
+	if assert.ErrorAs(t, err, &quotaErr) {
+		assert.WithinDuration(t, time.Now().Add(balancer.QuotaResetAfter), quotaErr.Reset, time.Second)
+	}
+	assert.Equal(t, []int{0, 0}, balancer.GetWeights())
+
+	single := lb.NewLoadBalancer(handler)
+	_, err = single.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrQuotaExhausted)
+	_, err = single.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrQuotaExhausted)
+}
+
+// Tests that the reset reported is that of a handler still out of quota, not
+// of one that never was or has come back since.
+func TestQuotaResetOfExhaustedOnly(t *testing.T) {
+	var calls atomic.Int32
+	soon := time.Now().Add(20 * time.Millisecond)
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				if calls.Add(1) == 1 {
+					return 0, &lb.QuotaExhaustedError{Reset: soon}
+				}
+				return param, nil
+			},
+		},
+		lb.Handler[int, int]{
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				return 0, lb.ErrQuotaExhausted
+			},
+		},
+	)
+	balancer.ExplorationRate = 0
+
+	_, err := balancer.Dispatch(context.Background(), 1)
+	var quotaErr *lb.QuotaExhaustedError
+	if assert.ErrorAs(t, err, &quotaErr) {
+		assert.True(t, quotaErr.Reset.Equal(soon))
+	}
+	assert.Equal(t, quotaErr, balancer.Health())
+
+	// The first handler is back, the second one is the only one out now
+	time.Sleep(time.Until(soon))
+	assert.NoError(t, balancer.Health())
+	res, err := balancer.Dispatch(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res)
+}
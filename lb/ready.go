@@ -0,0 +1,60 @@
+package lb
+
+import "context"
+
+// Blocks until the load balancer has handlers whose estimated capacities add
+// up to at least minCapacity, in tasks per second, or the context is done.
+// Handlers that are out of quota don't count. Use it to hold back traffic until
+// the handlers are known to be able to take it, e.g. after [LoadBalancer.Seed]
+// or a few ticks of probing.
+func (l *LoadBalancer[T, U]) AwaitReady(ctx context.Context, minCapacity float64) error {
+	for {
+		l.mut.Lock()
+		ready := len(l.dispatch) > 0 && l.totalCap >= minCapacity
+		changed := l.changed
+		l.mut.Unlock()
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Reports whether any handler can currently be dispatched to. Suitable for
+// readiness probes.
+func (l *LoadBalancer[T, U]) Healthy() bool {
+	return l.Health() == nil
+}
+
+// Returns nil if a dispatch could currently go to a handler, otherwise the
+// reason none can: [ErrShuttingDown] once [LoadBalancer.Shutdown] was called,
+// [ErrNoHandlers] if there are none, or a [QuotaExhaustedError] with the
+// earliest reset time if they are all out of quota. Handlers cooling down or
+// quarantined count, as dispatches go to them when there is nothing else.
+func (l *LoadBalancer[T, U]) Health() error {
+	l.admission.mut.Lock()
+	draining := l.admission.draining
+	l.admission.mut.Unlock()
+	if draining {
+		return ErrShuttingDown
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	if len(l.dispatch) == 0 {
+		return ErrNoHandlers
+	}
+
+	now := l.now()
+	for i := range l.dispatch {
+		if l.routable(i, now, false) {
+			return nil
+		}
+	}
+	return l.quotaError(now)
+}
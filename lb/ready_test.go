@@ -0,0 +1,93 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAwaitReady(t *testing.T) {
+	balancer := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+
+	assert.NoError(t, balancer.AwaitReady(context.Background(), 2))
+
+	ready := make(chan error)
+	go func() {
+		ready <- balancer.AwaitReady(context.Background(), 10)
+	}()
+
+	balancer.SetAllCapacities([]float64{3, 3})
+	select {
+	case <-ready:
+		t.Fatal("ready too early")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	balancer.SetAllCapacities([]float64{5, 6})
+	select {
+	case err := <-ready:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("never got ready")
+	}
+}
+
+func TestAwaitReadyTimeout(t *testing.T) {
+	balancer := lb.NewLoadBalancer[int, int]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, balancer.AwaitReady(ctx, 0), context.DeadlineExceeded)
+}
+
+func TestHealth(t *testing.T) {
+	assert.ErrorIs(t, lb.NewLoadBalancer[int, int]().Health(), lb.ErrNoHandlers)
+
+	reset := time.Now().Add(time.Hour)
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, &lb.QuotaExhaustedError{Reset: reset}
+		},
+	})
+	assert.True(t, balancer.Healthy())
+
+	balancer.Dispatch(context.Background(), 1)
+	assert.False(t, balancer.Healthy())
+	var quotaErr *lb.QuotaExhaustedError
+	assert.ErrorAs(t, balancer.Health(), &quotaErr)
+	assert.True(t, reset.Equal(quotaErr.Reset))
+}
+
+func TestHealthShutdown(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			close(started)
+			<-gate
+			return param, nil
+		},
+	})
+	go balancer.Dispatch(context.Background(), 1)
+	<-started
+	assert.NoError(t, balancer.Health())
+
+	// Unhealthy as soon as it starts draining, not once it is done
+	closed := make(chan error)
+	go func() {
+		closed <- balancer.Close(context.Background())
+	}()
+	assert.Eventually(t, func() bool {
+		return errors.Is(balancer.Health(), lb.ErrShuttingDown)
+	}, time.Second, time.Millisecond)
+	close(gate)
+	assert.NoError(t, <-closed)
+	assert.False(t, balancer.Healthy())
+}
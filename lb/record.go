@@ -0,0 +1,298 @@
+package lb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome of a single attempt to call a handler.
+type Outcome uint8
+
+const (
+	// The handler returned without error.
+	OutcomeSuccess Outcome = iota
+	// The handler returned some error other than [ErrExceedCap].
+	OutcomeError
+	// The handler returned [ErrExceedCap].
+	OutcomeRejected
+	// The handler returned [ErrQuotaExhausted].
+	OutcomeExhausted
+	// The caller gave up on the call, e.g. its context was cancelled,
+	// before the handler answered.
+	OutcomeCancelled
+)
+
+// Classifies the error returned by an attempt.
+func outcomeOf(err error) Outcome {
+	switch {
+	case errors.Is(err, ErrExceedCap):
+		return OutcomeRejected
+	case errors.Is(err, ErrQuotaExhausted):
+		return OutcomeExhausted
+	case err != nil:
+		return OutcomeError
+	}
+	return OutcomeSuccess
+}
+
+// A single attempt to call a handler.
+type Record struct {
+	Time time.Time
+	// Index of the handler at the time of the attempt
+	Handler int
+	// Identity of the handler, which unlike its index stays the same as
+	// handlers come and go. 0 in records written before it was recorded.
+	ID      int
+	Outcome Outcome
+	Latency time.Duration
+}
+
+// Returns a [Config.RecordSampler] that records one in every n successful
+// attempts, and every attempt with any other outcome since those are rare and
+// interesting.
+func SampleOneIn(n int) func(Record) bool {
+	var count atomic.Uint64
+	return func(rec Record) bool {
+		if rec.Outcome != OutcomeSuccess || n <= 1 {
+			return true
+		}
+		return count.Add(1)%uint64(n) == 1
+	}
+}
+
+// Writes [Record]s to an underlying writer in a compact binary format, which
+// can be read back with [ReadRecords]. Safe for concurrent use.
+//
+// The records are preceded by the bytes 0x01 and the format version, 2. Each
+// record is encoded as the varint nanoseconds since the previous record, the
+// uvarint handler index, a single outcome byte, the uvarint latency in
+// nanoseconds and the uvarint handler identity. Version 1 had no header, the
+// first record being at least decades after the epoch so never starting with
+// 0x01, and no identity.
+type Recorder struct {
+	w       *bufio.Writer
+	buf     []byte
+	last    int64 // unix nanos of the last record written
+	started bool  // whether the header was written
+	mut     sync.Mutex
+}
+
+// Marks the start of a versioned recording. As a version 1 record it would
+// be one at -1ns.
+const recordMagic = 0x01
+
+// Version of the format written by [Recorder].
+const recordVersion = 2
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		w:   bufio.NewWriter(w),
+		buf: make([]byte, 0, 4*binary.MaxVarintLen64+3),
+	}
+}
+
+func (r *Recorder) Record(rec Record) error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.buf = r.buf[:0]
+	if !r.started {
+		r.buf = append(r.buf, recordMagic, recordVersion)
+	}
+	now := rec.Time.UnixNano()
+	r.buf = binary.AppendVarint(r.buf, now-r.last)
+	r.buf = binary.AppendUvarint(r.buf, uint64(rec.Handler))
+	r.buf = append(r.buf, byte(rec.Outcome))
+	r.buf = binary.AppendUvarint(r.buf, uint64(rec.Latency))
+	r.buf = binary.AppendUvarint(r.buf, uint64(rec.ID))
+	r.last = now
+	r.started = true
+
+	_, err := r.w.Write(r.buf)
+	return err
+}
+
+// Flushes any buffered records to the underlying writer.
+func (r *Recorder) Flush() error {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.w.Flush()
+}
+
+// Reads back all records written by a [Recorder], of any version.
+func ReadRecords(r io.Reader) ([]Record, error) {
+	br := bufio.NewReader(r)
+	var records []Record
+	var last int64
+	version := 1
+	if magic, err := br.Peek(2); err == nil && magic[0] == recordMagic {
+		version = int(magic[1])
+		if version > recordVersion {
+			return nil, fmt.Errorf("lb unknown record version %d", version)
+		}
+		br.Discard(2)
+	}
+	for {
+		delta, err := binary.ReadVarint(br)
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		handler, err := binary.ReadUvarint(br)
+		if err != nil {
+			return records, unexpectedEOF(err)
+		}
+		outcome, err := br.ReadByte()
+		if err != nil {
+			return records, unexpectedEOF(err)
+		}
+		latency, err := binary.ReadUvarint(br)
+		if err != nil {
+			return records, unexpectedEOF(err)
+		}
+		var id uint64
+		if version >= 2 {
+			id, err = binary.ReadUvarint(br)
+			if err != nil {
+				return records, unexpectedEOF(err)
+			}
+		}
+
+		last += delta
+		records = append(records, Record{
+			Time:    time.Unix(0, last),
+			Handler: int(handler),
+			ID:      int(id),
+			Outcome: Outcome(outcome),
+			Latency: time.Duration(latency),
+		})
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Records an attempt with [Config.Recorder], if set and the attempt is sampled.
+// Records that fail to be written are counted, see
+// [LoadBalancer.RecordErrors].
+func (l *LoadBalancer[T, U]) recordAttempt(rec Record) {
+	if l.Recorder != nil && (l.RecordSampler == nil || l.RecordSampler(rec)) {
+		if err := l.Recorder.Record(rec); err != nil {
+			l.recordErrors.Add(1)
+		}
+	}
+}
+
+// Returns the number of attempts that [Config.Recorder] failed to write, e.g.
+// because the underlying writer failed. They are missing from the recording.
+func (l *LoadBalancer[T, U]) RecordErrors() int64 {
+	return l.recordErrors.Load()
+}
+
+// Re-runs recorded traffic through the capacity estimator with the given config
+// in virtual time, returning the weights and capacities it would have computed
+// at the end of every update interval, in the same form as
+// [LoadBalancer.History]. The handler choices in the trace are
+// taken as is, so this shows how a config would have reacted to the same
+// observations, not what traffic it would have generated.
+//
+// numHandlers is the number of handlers the trace was recorded with, and caps
+// are the initial capacities (leave nil to start from the default). The config
+// is best derived from [DefaultConfig].
+//
+// Latencies are taken from the records, and the calls running at once on each
+// handler from how the recorded calls overlap, so estimators that go by them
+// such as [NewLittlesLaw] can be replayed too. A trace sampled with
+// [Config.RecordSampler] undercounts them. Handlers that ran out of quota are
+// taken out of rotation for [Config.QuotaResetAfter] of recorded time, the
+// clock of the replay replacing [Config.Now].
+func Replay(records []Record, numHandlers int, caps []float64, config Config) []HistoryEntry {
+	handlers := make([]Handler[struct{}, struct{}], numHandlers)
+	for i := range handlers {
+		if i < len(caps) {
+			handlers[i].EstCap = caps[i]
+		}
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	now := records[0].Time // the virtual clock
+	l := NewLoadBalancer(handlers...)
+	l.Config = config
+	l.Now = func() time.Time { return now }
+	l.updateWeights()
+
+	if l.UpdateInterval <= 0 {
+		return nil
+	}
+
+	// when each call still running on each handler ends
+	running := make([][]time.Time, numHandlers)
+	finish := func(i int, t time.Time) {
+		running[i] = slices.DeleteFunc(running[i], func(end time.Time) bool {
+			return !end.After(t)
+		})
+		l.inFlight[i].Store(int32(len(running[i])))
+	}
+
+	var ticks []HistoryEntry
+	tick := func(t time.Time) {
+		now = t
+		for i := range running {
+			finish(i, t)
+		}
+		l.updateLoads()
+		l.updateWeights()
+		ticks = append(ticks, l.snapshot(t))
+	}
+
+	next := records[0].Time.Add(l.UpdateInterval)
+	for _, rec := range records {
+		for !rec.Time.Before(next) {
+			tick(next)
+			next = next.Add(l.UpdateInterval)
+		}
+		if rec.Handler < 0 || rec.Handler >= numHandlers {
+			continue
+		}
+		now = rec.Time
+		finish(rec.Handler, rec.Time)
+		running[rec.Handler] = append(running[rec.Handler], rec.Time.Add(rec.Latency))
+		inFlight := int32(len(running[rec.Handler]))
+		if inFlight > l.peakInFlight[rec.Handler].Load() {
+			l.peakInFlight[rec.Handler].Store(inFlight)
+		}
+		if rec.Outcome == OutcomeSuccess || rec.Outcome == OutcomeError {
+			l.latencies[rec.Handler].Add(int64(rec.Latency))
+			l.observeLatency(rec.Handler, l.LatencySmoothingFactor, rec.Latency)
+		}
+		switch rec.Outcome {
+		case OutcomeRejected:
+			l.rejections[rec.Handler].Add(1)
+		case OutcomeExhausted:
+			// not counted towards capacity, see ErrQuotaExhausted
+			l.exhaust(l.handlerSet, rec.Handler, ErrQuotaExhausted)
+		case OutcomeCancelled:
+			// says nothing about the handler
+		case OutcomeError:
+			l.errors[rec.Handler].Add(1)
+		default:
+			l.successes[rec.Handler].Add(1)
+		}
+	}
+	tick(next)
+
+	return ticks
+}
@@ -0,0 +1,245 @@
+package lb_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+	records := []lb.Record{
+		{Time: time.Unix(100, 0), Handler: 0, Outcome: lb.OutcomeSuccess, Latency: time.Millisecond},
+		{Time: time.Unix(100, 500), Handler: 3, ID: 7, Outcome: lb.OutcomeRejected, Latency: 0},
+		{Time: time.Unix(99, 0), Handler: 1, Outcome: lb.OutcomeError, Latency: time.Second},
+	}
+
+	var buf bytes.Buffer
+	recorder := lb.NewRecorder(&buf)
+	for _, rec := range records {
+		assert.NoError(t, recorder.Record(rec))
+	}
+	assert.NoError(t, recorder.Flush())
+
+	read, err := lb.ReadRecords(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, records, read)
+}
+
+// Tests that recordings made before handler identities were recorded can
+// still be read.
+func TestRecordVersion1(t *testing.T) {
+	var buf []byte
+	buf = binary.AppendVarint(buf, time.Unix(100, 0).UnixNano())
+	buf = binary.AppendUvarint(buf, 2)
+	buf = append(buf, byte(lb.OutcomeError))
+	buf = binary.AppendUvarint(buf, uint64(time.Millisecond))
+
+	read, err := lb.ReadRecords(bytes.NewReader(buf))
+	assert.NoError(t, err)
+	assert.Equal(t, []lb.Record{
+		{Time: time.Unix(100, 0), Handler: 2, Outcome: lb.OutcomeError, Latency: time.Millisecond},
+	}, read)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRecordErrors(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.Recorder = lb.NewRecorder(failingWriter{})
+
+	// Enough to fill the buffer of the recorder
+	for i := range 1000 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Positive(t, balancer.RecordErrors())
+	assert.Less(t, balancer.RecordErrors(), int64(1000))
+}
+
+func TestRecordDispatches(t *testing.T) {
+	var buf bytes.Buffer
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.Recorder = lb.NewRecorder(&buf)
+
+	for i := range 5 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.NoError(t, balancer.Recorder.Flush())
+
+	read, err := lb.ReadRecords(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Len(t, read, 5)
+	for _, rec := range read {
+		assert.Equal(t, 0, rec.Handler)
+		assert.Equal(t, lb.OutcomeSuccess, rec.Outcome)
+	}
+
+	// Identities stay with the handler as indices shift
+	balancer.AddHandler(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.RemoveHandler(0)
+	balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, balancer.Recorder.Flush())
+	all, err := lb.ReadRecords(&buf)
+	assert.NoError(t, err)
+	if assert.Len(t, all, 6) {
+		assert.Equal(t, 0, all[5].Handler)
+		assert.NotEqual(t, all[0].ID, all[5].ID)
+	}
+}
+
+func TestRecordSampler(t *testing.T) {
+	var buf bytes.Buffer
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			if param%5 == 0 {
+				return 0, errors.New("broken")
+			}
+			return param, nil
+		},
+	})
+	balancer.Recorder = lb.NewRecorder(&buf)
+	balancer.RecordSampler = lb.SampleOneIn(4)
+
+	for i := range 20 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.NoError(t, balancer.Recorder.Flush())
+
+	read, err := lb.ReadRecords(&buf)
+	assert.NoError(t, err)
+	errs := 0
+	for _, rec := range read {
+		if rec.Outcome == lb.OutcomeError {
+			errs++
+		}
+	}
+	// Every error, and one in four of the 16 successes
+	assert.Equal(t, 4, errs)
+	assert.Len(t, read, 8)
+}
+
+// Tests that replaying a trace where one handler consistently serves more
+// converges towards it, and that different configs give different results.
+func TestReplay(t *testing.T) {
+	var records []lb.Record
+	start := time.Unix(1000, 0)
+	for sec := range 5 {
+		for i := range 8 {
+			records = append(records, lb.Record{
+				Time:    start.Add(time.Duration(sec)*time.Second + time.Duration(i)*time.Millisecond),
+				Handler: 0,
+				Outcome: lb.OutcomeSuccess,
+			})
+		}
+		for i := range 2 {
+			records = append(records, lb.Record{
+				Time:    start.Add(time.Duration(sec)*time.Second + time.Duration(i)*time.Millisecond),
+				Handler: 1,
+				Outcome: lb.OutcomeSuccess,
+			})
+		}
+	}
+
+	ticks := lb.Replay(records, 2, nil, lb.DefaultConfig())
+	assert.Len(t, ticks, 5)
+	last := ticks[len(ticks)-1]
+	assert.InDelta(t, 80, last.Weights[0], 5)
+	assert.InDelta(t, 20, last.Weights[1], 5)
+
+	// with no smoothing towards the observed rate it barely moves
+	config := lb.DefaultConfig()
+	config.SmoothingFactor = 0
+	ticks = lb.Replay(records, 2, nil, config)
+	last = ticks[len(ticks)-1]
+	assert.InDelta(t, 50, last.Weights[0], 5)
+}
+
+// Tests that replaying a trace works for estimators that go by latency and
+// concurrency rather than by calls.
+func TestReplayLittlesLaw(t *testing.T) {
+	var records []lb.Record
+	start := time.Unix(1000, 0)
+	for slot := range 50 {
+		at := start.Add(time.Duration(slot) * 100 * time.Millisecond)
+		// 4 calls at once on handler 0, 1 on handler 1, all taking 100ms
+		for handler, concurrency := range []int{4, 1} {
+			for range concurrency {
+				records = append(records, lb.Record{
+					Time:    at,
+					Handler: handler,
+					Outcome: lb.OutcomeSuccess,
+					Latency: 100 * time.Millisecond,
+				})
+			}
+		}
+	}
+
+	config := lb.DefaultConfig()
+	config.Estimator = lb.NewLittlesLaw(0)
+	ticks := lb.Replay(records, 2, []float64{10, 10}, config)
+	assert.Len(t, ticks, 5)
+	last := ticks[len(ticks)-1]
+	assert.InDelta(t, 40, last.Caps[0], 1)
+	assert.InDelta(t, 10, last.Caps[1], 1)
+}
+
+// Tests that quotas run out on the recorded clock when replaying.
+func TestReplayQuota(t *testing.T) {
+	var records []lb.Record
+	start := time.Unix(1000, 0)
+	for sec := range 5 {
+		for handler := range 2 {
+			for i := range 5 {
+				records = append(records, lb.Record{
+					Time:    start.Add(time.Duration(sec)*time.Second + time.Duration(i)*time.Millisecond),
+					Handler: handler,
+					Outcome: lb.OutcomeSuccess,
+				})
+			}
+		}
+	}
+	records = append(records, lb.Record{
+		Time:    start.Add(500 * time.Millisecond),
+		Handler: 0,
+		Outcome: lb.OutcomeExhausted,
+	})
+	slices.SortStableFunc(records, func(a, b lb.Record) int {
+		return a.Time.Compare(b.Time)
+	})
+
+	config := lb.DefaultConfig()
+	config.QuotaResetAfter = 2 * time.Second
+	ticks := lb.Replay(records, 2, []float64{5, 5}, config)
+	if assert.Len(t, ticks, 5) {
+		assert.Equal(t, 0, ticks[0].Weights[0])
+		assert.Equal(t, 0, ticks[1].Weights[0])
+		assert.Positive(t, ticks[2].Weights[0])
+		assert.Positive(t, ticks[4].Weights[0])
+	}
+}
@@ -0,0 +1,81 @@
+package lb
+
+import "time"
+
+// What happened to a single handler over one tick.
+type HandlerTick struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Calls this instance made to the handler during the tick, including
+	// failed ones
+	Calls float64 `json:"calls"`
+	// Number of those calls that failed
+	Errors float64 `json:"errors"`
+	// Number of times the handler returned [ErrExceedCap]
+	Rejections float64 `json:"rejections"`
+	// Whether the handler is out of quota, in which case its capacity is
+	// left alone and it gets no weight
+	Exhausted bool `json:"exhausted"`
+	// Estimated capacity after the tick, in tasks per second
+	Capacity float64 `json:"capacity"`
+	// Change in estimated capacity over the tick
+	CapacityDelta float64 `json:"capacity_delta"`
+	// Round robin weight after the tick
+	Weight int `json:"weight"`
+	// Change in weight over the tick
+	WeightDelta int `json:"weight_delta"`
+}
+
+// Everything a single tick did, see [Config.OnTick].
+type TickReport struct {
+	Time time.Time `json:"time"`
+	// Sum of the capacities of the handlers that aren't out of quota
+	TotalCapacity float64 `json:"total_capacity"`
+	// Number of handlers out of quota
+	Exhausted int           `json:"exhausted"`
+	Handlers  []HandlerTick `json:"handlers"`
+	// Dispatches waiting and dropped under [Config.MaxInFlight]
+	Queue QueueStats `json:"queue"`
+}
+
+// Starts the report of a tick from the samples taken this tick, before they
+// are applied. Needs the lock.
+func (l *LoadBalancer[T, U]) startReport(t time.Time, samples []*Sample) TickReport {
+	weights := l.WeightedRoundRobin.GetWeights()
+	report := TickReport{
+		Time:     t,
+		Handlers: make([]HandlerTick, len(samples)),
+	}
+	for i, sample := range samples {
+		h := HandlerTick{
+			Index:         i,
+			Name:          l.names[i],
+			Exhausted:     sample == nil,
+			CapacityDelta: -l.caps[i],
+			WeightDelta:   -weights[i],
+		}
+		if sample != nil {
+			h.Calls = sample.Calls
+			h.Errors = sample.Errors
+			h.Rejections = sample.Rejections
+		} else {
+			report.Exhausted++
+		}
+		report.Handlers[i] = h
+	}
+	return report
+}
+
+// Fills in the state after the tick. Needs the lock.
+func (l *LoadBalancer[T, U]) finishReport(report *TickReport) {
+	weights := l.WeightedRoundRobin.GetWeights()
+	report.TotalCapacity = l.totalCap
+	report.Queue = l.admission.stats()
+	for i := range report.Handlers {
+		h := &report.Handlers[i]
+		h.Capacity = l.caps[i]
+		h.CapacityDelta += l.caps[i]
+		h.Weight = weights[i]
+		h.WeightDelta += weights[i]
+	}
+}
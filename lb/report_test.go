@@ -0,0 +1,68 @@
+package lb_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTickReport(t *testing.T) {
+	ok := lb.Handler[int, int]{
+		Name:   "ok",
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	}
+	out := lb.Handler[int, int]{
+		Name:   "out",
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, &lb.QuotaExhaustedError{Reset: time.Now().Add(time.Hour)}
+		},
+	}
+	balancer := lb.NewLoadBalancer(ok, out)
+	balancer.ExplorationRate = 0
+
+	var reports []lb.TickReport
+	balancer.OnTick = func(report lb.TickReport) {
+		// Must not deadlock
+		balancer.GetStats()
+		reports = append(reports, report)
+	}
+
+	before := balancer.GetCapacities()
+	for i := range 10 {
+		_, err := balancer.Dispatch(context.Background(), i)
+		assert.NoError(t, err)
+	}
+	balancer.TickOnce()
+
+	assert.Len(t, reports, 1)
+	report := reports[0]
+	assert.Equal(t, 1, report.Exhausted)
+	assert.Equal(t, balancer.GetCapacities()[0], report.TotalCapacity)
+
+	assert.Equal(t, "ok", report.Handlers[0].Name)
+	assert.Equal(t, 10.0, report.Handlers[0].Calls)
+	assert.False(t, report.Handlers[0].Exhausted)
+	assert.True(t, report.Handlers[1].Exhausted)
+
+	weightDelta := 0
+	for i, h := range report.Handlers {
+		assert.Equal(t, i, h.Index)
+		assert.InDelta(t, h.Capacity-before[i], h.CapacityDelta, 1e-9)
+		assert.Equal(t, balancer.GetWeights()[i], h.Weight)
+		weightDelta += h.WeightDelta
+	}
+	assert.Equal(t, 0, weightDelta)
+
+	data, err := json.Marshal(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"total_capacity"`)
+	assert.Contains(t, string(data), `"capacity_delta"`)
+}
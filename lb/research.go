@@ -0,0 +1,50 @@
+package lb
+
+import (
+	"encoding/csv"
+	"strconv"
+	"time"
+)
+
+// Columns of the CSV written to [Config.ResearchLog], one row per estimate:
+//
+//   - time: when the estimate was made, RFC 3339 with nanoseconds
+//   - handler, name: index and [Handler.Name] of the handler
+//   - capacity_before: estimated capacity going in, tasks per second
+//   - calls, errors, rejections, latency_ns, in_flight, period_ns: the
+//     [Sample] the estimator was given
+//   - capacity_after: the new estimate, after clamping to [Handler.MaxRate]
+//
+// The header is written before the first row.
+var ResearchColumns = []string{
+	"time", "handler", "name", "capacity_before",
+	"calls", "errors", "rejections", "latency_ns", "in_flight", "period_ns",
+	"capacity_after",
+}
+
+// Writes a row for the estimate of handler i to [Config.ResearchLog]. Errors
+// writing are ignored, research must never get in the way of dispatching.
+// Needs the lock.
+func (l *LoadBalancer[T, U]) logEstimate(i int, s Sample, capacity float64) {
+	if l.research == nil {
+		l.research = csv.NewWriter(l.ResearchLog)
+		l.research.Write(ResearchColumns)
+	}
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	l.research.Write([]string{
+		time.Now().Format(time.RFC3339Nano),
+		strconv.Itoa(i),
+		l.names[i],
+		float(l.caps[i]),
+		float(s.Calls),
+		float(s.Errors),
+		float(s.Rejections),
+		strconv.FormatInt(int64(s.Latency), 10),
+		strconv.Itoa(s.InFlight),
+		strconv.FormatInt(int64(s.Period), 10),
+		float(capacity),
+	})
+	l.research.Flush()
+}
@@ -0,0 +1,36 @@
+package lb_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResearchLog(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	downstreams[1].Name = "second"
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.Estimator = lb.NewWindowAverage(1)
+	var buf bytes.Buffer
+	balancer.ResearchLog = &buf
+
+	balancer.Seed([]lb.Observation{
+		{Handler: 1, Calls: 4, Errors: 1, Rejections: 2, Period: time.Second},
+	})
+	balancer.TickOnce()
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Equal(t, lb.ResearchColumns, rows[0])
+	assert.Equal(t, []string{"1", "second", "1", "4", "1", "2", "0", "0", "1000000000", "4"}, rows[1][1:])
+	_, err = time.Parse(time.RFC3339Nano, rows[1][0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0", ""}, rows[2][1:3])
+	assert.Equal(t, []string{"1", "second", "4"}, rows[3][1:4])
+}
@@ -0,0 +1,68 @@
+package lb
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// The partial result of one handler in [LoadBalancer.Scatter].
+type Result[U any] struct {
+	// Index of the handler
+	Index int
+	// Name of the handler
+	Name  string
+	Value U
+	Err   error
+}
+
+// Sends the request to every handler at once, e.g. every shard of a sharded
+// backend, and streams back their partial results as they complete. The
+// channel is closed once every handler is done. Each handler is backed off and
+// retried as usual, but never swapped for another one, and its calls and errors
+// are accounted for as usual so [LoadBalancer.GetStats] tracks the health of
+// each shard. The handlers are those there are when it is called, even if some
+// are added or removed before they all complete.
+//
+// Every call made counts as a dispatch towards [Config.MaxInFlight], waiting
+// for a slot or being shed like any other, and [LoadBalancer.Shutdown] refuses
+// and waits for them likewise.
+func (l *LoadBalancer[T, U]) Scatter(ctx context.Context, param T) <-chan Result[U] {
+	set := l.handlers()
+	results := make(chan Result[U], len(set.dispatch))
+
+	var wg sync.WaitGroup
+	for i := range set.dispatch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots, err := l.admit(ctx)
+			if err != nil {
+				results <- Result[U]{Index: i, Name: set.names[i], Err: err}
+				return
+			}
+			defer l.release(slots)
+			res, err := l.tryDispatch(ctx, param, set, i, DispatchOpts{pinned: true})
+			results <- Result[U]{Index: i, Name: set.names[i], Value: res, Err: err}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+// Like [LoadBalancer.Scatter], but waits for every handler and returns their
+// results in handler order.
+func (l *LoadBalancer[T, U]) Gather(ctx context.Context, param T) []Result[U] {
+	var results []Result[U]
+	for res := range l.Scatter(ctx, param) {
+		results = append(results, res)
+	}
+	slices.SortFunc(results, func(a, b Result[U]) int {
+		return a.Index - b.Index
+	})
+	return results
+}
@@ -0,0 +1,93 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func newShards() *lb.LoadBalancer[string, string] {
+	shard := func(name string) lb.Handler[string, string] {
+		return lb.Handler[string, string]{
+			Name:   name,
+			EstCap: 1,
+			Dispatch: func(ctx context.Context, query string) (string, error) {
+				if name == "broken" {
+					return "", errors.New("shard down")
+				}
+				return name + ":" + query, nil
+			},
+		}
+	}
+	return lb.NewLoadBalancer(shard("a"), shard("b"), shard("broken"))
+}
+
+func TestScatter(t *testing.T) {
+	balancer := newShards()
+	balancer.Deflect = true
+
+	seen := map[int]lb.Result[string]{}
+	for res := range balancer.Scatter(context.Background(), "q") {
+		seen[res.Index] = res
+	}
+	assert.Len(t, seen, 3)
+	assert.Equal(t, "a:q", seen[0].Value)
+	assert.Equal(t, "b:q", seen[1].Value)
+	assert.Equal(t, "broken", seen[2].Name)
+	assert.Error(t, seen[2].Err)
+}
+
+func TestGather(t *testing.T) {
+	balancer := newShards()
+
+	results := balancer.Gather(context.Background(), "q")
+	assert.Len(t, results, 3)
+	for i, res := range results {
+		assert.Equal(t, i, res.Index)
+	}
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "b:q", results[1].Value)
+	assert.Error(t, results[2].Err)
+}
+
+func TestScatterCancelled(t *testing.T) {
+	balancer := newShards()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, res := range balancer.Gather(ctx, "q") {
+		assert.ErrorIs(t, res.Err, context.Canceled)
+	}
+}
+
+func TestScatterAdmission(t *testing.T) {
+	gate := make(chan struct{})
+	shard := lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-gate
+			return param, nil
+		},
+	}
+	balancer := lb.NewLoadBalancer(shard, shard, shard)
+	balancer.MaxInFlight = 2
+	balancer.ShedWhenFull = true
+
+	results := balancer.Scatter(context.Background(), 1)
+	// The other two hold both slots until the gate opens
+	res := <-results
+	assert.ErrorIs(t, res.Err, lb.ErrShed)
+	close(gate)
+	for res := range results {
+		assert.NoError(t, res.Err)
+	}
+
+	_, err := balancer.Shutdown(context.Background())
+	assert.NoError(t, err)
+	for _, res := range balancer.Gather(context.Background(), 1) {
+		assert.ErrorIs(t, res.Err, lb.ErrShuttingDown)
+	}
+}
@@ -0,0 +1,33 @@
+package lb
+
+import "time"
+
+// Returns the scheduled capacity multiplier of handler i at t, see
+// [Handler.CapacitySchedule].
+func (l *LoadBalancer[T, U]) multiplier(i int, t time.Time) float64 {
+	if l.schedules[i] == nil {
+		return 1
+	}
+	return max(l.schedules[i](t), 0)
+}
+
+// Returns a [Handler.CapacitySchedule] that multiplies capacity by factor every
+// day from the time of day from until the time of day to, in the location of
+// the time it is given. The window may wrap around midnight, e.g. from 22h to
+// 6h.
+//
+//	lb.DailyMultiplier(9*time.Hour, 17*time.Hour, 0.5)
+func DailyMultiplier(from, to time.Duration, factor float64) func(time.Time) float64 {
+	return func(t time.Time) float64 {
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		now := t.Sub(midnight)
+		inside := from <= now && now < to
+		if from > to {
+			inside = now >= from || now < to
+		}
+		if inside {
+			return factor
+		}
+		return 1
+	}
+}
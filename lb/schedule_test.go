@@ -0,0 +1,43 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyMultiplier(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 1, hour, 30, 0, 0, time.UTC)
+	}
+
+	office := lb.DailyMultiplier(9*time.Hour, 17*time.Hour, 0.5)
+	assert.Equal(t, 1.0, office(at(8)))
+	assert.Equal(t, 0.5, office(at(9)))
+	assert.Equal(t, 0.5, office(at(16)))
+	assert.Equal(t, 1.0, office(at(17)))
+
+	night := lb.DailyMultiplier(22*time.Hour, 6*time.Hour, 2)
+	assert.Equal(t, 2.0, night(at(23)))
+	assert.Equal(t, 2.0, night(at(1)))
+	assert.Equal(t, 1.0, night(at(12)))
+}
+
+func TestCapacitySchedule(t *testing.T) {
+	handler := func(ctx context.Context, param int) (int, error) {
+		return param, nil
+	}
+	busy := func(time.Time) float64 { return 0.5 }
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 1, Dispatch: handler, CapacitySchedule: busy},
+		lb.Handler[int, int]{EstCap: 1, Dispatch: handler},
+	)
+
+	assert.NoError(t, balancer.SetAllCapacities([]float64{60, 30}))
+	// The learned estimate is left alone, only the weights change
+	assert.Equal(t, []float64{60, 30}, balancer.GetCapacities())
+	assert.Equal(t, []int{50, 50}, balancer.GetWeights())
+}
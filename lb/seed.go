@@ -0,0 +1,45 @@
+package lb
+
+import "time"
+
+// What was seen of a single handler over some period, e.g. taken from
+// historical metrics.
+type Observation struct {
+	// Index of the handler
+	Handler int
+	// Number of tasks the handler completed over the period, including
+	// failed ones
+	Calls int
+	// Number of those tasks that failed
+	Errors int
+	// Number of times the handler returned [ErrExceedCap] over the period
+	Rejections int
+	// Length of the period, defaults to [Config.UpdateInterval]
+	Period time.Duration
+}
+
+// Feeds historical observations through the capacity estimator, in order, as if
+// they had just been observed. Use this right after construction so a fresh
+// load balancer starts from realistic capacities instead of the handlers'
+// EstCap. Observations for unknown handlers are ignored.
+func (l *LoadBalancer[T, U]) Seed(observations []Observation) {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	for _, o := range observations {
+		if o.Handler < 0 || o.Handler >= len(l.caps) {
+			continue
+		}
+		period := o.Period
+		if period <= 0 {
+			period = l.UpdateInterval
+		}
+		l.updateLoad(o.Handler, Sample{
+			Calls:      float64(o.Calls),
+			Errors:     float64(o.Errors),
+			Rejections: float64(o.Rejections),
+			Period:     period,
+		})
+	}
+	l.updateWeights()
+}
@@ -0,0 +1,54 @@
+package lb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeed(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+
+	var observations []lb.Observation
+	for range 20 {
+		observations = append(observations,
+			lb.Observation{Handler: 0, Calls: 60, Period: time.Minute},
+			lb.Observation{Handler: 1, Calls: 3},
+			lb.Observation{Handler: 5, Calls: 100},
+		)
+	}
+	balancer.Seed(observations)
+
+	caps := balancer.GetCapacities()
+	assert.InDelta(t, 1.1, caps[0], 0.1)
+	assert.InDelta(t, 3.1, caps[1], 0.1)
+	assert.InDelta(t, 25, balancer.GetWeights()[0], 2)
+	assert.InDelta(t, 75, balancer.GetWeights()[1], 2)
+}
+
+// Tests that a handler that fails most of its calls only looks fast when
+// weighting by throughput.
+func TestSeedGoodput(t *testing.T) {
+	var observations []lb.Observation
+	for range 20 {
+		observations = append(observations,
+			lb.Observation{Handler: 0, Calls: 10, Errors: 9},
+			lb.Observation{Handler: 1, Calls: 5},
+		)
+	}
+
+	throughput := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+	throughput.Seed(observations)
+	weights := throughput.GetWeights()
+	assert.Greater(t, weights[0], weights[1])
+
+	goodput := lb.NewLoadBalancer(utils.NewRateLimitedDownstreams(1, 1)...)
+	goodput.WeightByGoodput = true
+	goodput.Seed(observations)
+	weights = goodput.GetWeights()
+	assert.Less(t, weights[0], weights[1])
+}
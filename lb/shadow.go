@@ -0,0 +1,156 @@
+package lb
+
+import (
+	"sync"
+	"time"
+)
+
+// A [Strategy] that routes with a live strategy while running a candidate in
+// its shadow on the same traffic, to compare them before switching, see
+// [Shadow.Report]. The shadow is asked for its choice on every dispatch the
+// live strategy routes, but its choices are only counted, never acted on.
+//
+//	shadow := lb.NewShadow(balancer.GetStrategy(), lb.PowerOfTwoChoices())
+//	balancer.SetStrategy(shadow)
+//	...
+//	report := shadow.Report(balancer.GetStats())
+type Shadow struct {
+	live   Strategy
+	shadow Strategy
+
+	mut       sync.Mutex
+	since     time.Time
+	picks     int64
+	agreed    int64
+	livePicks []int64 // handlers chosen by the live strategy
+	shadowed  []int64 // handlers the shadow would have chosen
+}
+
+// Returns a [Shadow] routing with live and scoring shadow. They must be
+// different instances.
+func NewShadow(live, shadow Strategy) *Shadow {
+	return &Shadow{live: live, shadow: shadow, since: time.Now()}
+}
+
+func (s *Shadow) SetWeights(weights []int) {
+	s.live.SetWeights(weights)
+	s.shadow.SetWeights(weights)
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if len(weights) != len(s.livePicks) {
+		// Handlers came or went, the counts no longer line up
+		s.reset(len(weights))
+	}
+}
+
+func (s *Shadow) SetInFlight(inFlight func(index int) int) {
+	for _, strategy := range []Strategy{s.live, s.shadow} {
+		if f, ok := strategy.(StrategyInFlight); ok {
+			f.SetInFlight(inFlight)
+		}
+	}
+}
+
+// Hands prev over to the live strategy.
+func (s *Shadow) Handoff(prev Strategy) {
+	if h, ok := s.live.(StrategyHandoff); ok {
+		h.Handoff(prev)
+	}
+}
+
+func (s *Shadow) Next(usable func(index int) bool) (int, bool) {
+	hypothetical, hok := s.shadow.Next(usable)
+	index, ok := s.live.Next(usable)
+	if !ok {
+		return index, ok
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.picks++
+	s.livePicks[index]++
+	if hok {
+		s.shadowed[hypothetical]++
+		if hypothetical == index {
+			s.agreed++
+		}
+	}
+	return index, ok
+}
+
+// Resets the counts for n handlers. Needs the lock.
+func (s *Shadow) reset(n int) {
+	s.since = time.Now()
+	s.picks, s.agreed = 0, 0
+	s.livePicks = make([]int64, n)
+	s.shadowed = make([]int64, n)
+}
+
+// Comparison of the live and shadow strategies of a [Shadow].
+type ShadowReport struct {
+	// When counting started, on creation or the last time handlers came or
+	// went
+	Since time.Time `json:"since"`
+	// Dispatches routed by the live strategy
+	Picks int64 `json:"picks"`
+	// How many of them the shadow would have sent to the same handler
+	Agreed int64 `json:"agreed"`
+	// Share of the dispatches each handler got, and would have got from
+	// the shadow
+	LiveShares   []float64 `json:"live_shares"`
+	ShadowShares []float64 `json:"shadow_shares"`
+	// Expected latency of a dispatch, from the handlers' moving average
+	// latencies weighted by their shares. The shadow's is hypothetical.
+	LiveLatency   time.Duration `json:"live_latency"`
+	ShadowLatency time.Duration `json:"shadow_latency"`
+	// Highest rate of dispatches, in tasks per second, that could be
+	// spread this way before some handler exceeds its estimated capacity.
+	LiveThroughput   float64 `json:"live_throughput"`
+	ShadowThroughput float64 `json:"shadow_throughput"`
+}
+
+// Compares what the live strategy did with what the shadow would have done,
+// going by the current stats of the handlers, see [LoadBalancer.GetStats].
+func (s *Shadow) Report(stats []HandlerStats) ShadowReport {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	r := ShadowReport{Since: s.since, Picks: s.picks, Agreed: s.agreed}
+	if len(stats) != len(s.livePicks) {
+		return r
+	}
+	r.LiveShares, r.LiveLatency, r.LiveThroughput = score(s.livePicks, stats)
+	r.ShadowShares, r.ShadowLatency, r.ShadowThroughput = score(s.shadowed, stats)
+	return r
+}
+
+// Returns the share of each handler in picks, and the expected latency and
+// highest throughput of spreading dispatches that way.
+func score(picks []int64, stats []HandlerStats) ([]float64, time.Duration, float64) {
+	var total int64
+	for _, p := range picks {
+		total += p
+	}
+	shares := make([]float64, len(picks))
+	if total == 0 {
+		return shares, 0, 0
+	}
+
+	var latency, throughput float64
+	for i, p := range picks {
+		shares[i] = float64(p) / float64(total)
+		if shares[i] == 0 {
+			continue
+		}
+		latency += shares[i] * float64(stats[i].Latency)
+		if limit := stats[i].Capacity / shares[i]; throughput == 0 || limit < throughput {
+			throughput = limit
+		}
+	}
+	return shares, time.Duration(latency), throughput
+}
+
+func (s *Shadow) DebugState() any {
+	return s.Report(nil)
+}
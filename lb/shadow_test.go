@@ -0,0 +1,55 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShadow(t *testing.T) {
+	var chosen []int
+	handler := func(ctx context.Context, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		chosen = append(chosen, info.Index)
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 30, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	balancer.LatencySmoothingFactor = 0
+	balancer.RecordResult(context.Background(), 0, nil, 10*time.Millisecond)
+	balancer.RecordResult(context.Background(), 1, nil, 30*time.Millisecond)
+
+	// Idle, least outstanding by capacity always goes for the bigger handler
+	shadow := lb.NewShadow(balancer.GetStrategy(), lb.LeastOutstanding(true))
+	balancer.SetStrategy(shadow)
+	for i := range 100 {
+		balancer.Dispatch(context.Background(), i)
+	}
+
+	// Routing is left to the live strategy
+	counts := map[int]int{}
+	for _, index := range chosen {
+		counts[index]++
+	}
+	assert.Equal(t, map[int]int{0: 25, 1: 75}, counts)
+
+	report := shadow.Report(balancer.GetStats())
+	assert.Equal(t, int64(100), report.Picks)
+	assert.Equal(t, int64(75), report.Agreed)
+	assert.Equal(t, []float64{0.25, 0.75}, report.LiveShares)
+	assert.Equal(t, []float64{0, 1}, report.ShadowShares)
+	assert.Equal(t, 25*time.Millisecond, report.LiveLatency)
+	assert.Equal(t, 30*time.Millisecond, report.ShadowLatency)
+	assert.InDelta(t, 40, report.LiveThroughput, 0.01)
+	assert.InDelta(t, 30, report.ShadowThroughput, 0.01)
+
+	// Counting starts over when handlers come or go
+	balancer.AddHandler(lb.Handler[int, int]{EstCap: 10, Dispatch: handler})
+	assert.Zero(t, shadow.Report(balancer.GetStats()).Picks)
+}
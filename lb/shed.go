@@ -0,0 +1,87 @@
+package lb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Which dispatch to turn away when the queue under [Config.MaxInFlight] is
+// full, see [Config.MaxQueue]. Waiting dispatches are always served oldest
+// first.
+type ShedStrategy int
+
+const (
+	// Turn away the dispatch that just arrived.
+	ShedNewest ShedStrategy = iota
+	// Drop the dispatch that has been waiting the longest, it is the most
+	// likely to be stale by the time it runs.
+	ShedOldest
+	// Drop the dispatch with the lowest priority, see [WithPriority]. Ties
+	// go to the newest.
+	ShedLowestPriority
+	// Drop the dispatch with the earliest deadline if it is unlikely to be
+	// met, given how long dispatches have been waiting recently. Otherwise
+	// turn away the newest.
+	ShedByDeadline
+)
+
+type priorityKey struct{}
+
+// Returns a context that gives any dispatch made with it the given priority,
+// for [ShedLowestPriority]. The default priority is 0, higher is more
+// important.
+func WithPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func priority(ctx context.Context) int {
+	p, _ := ctx.Value(priorityKey{}).(int)
+	return p
+}
+
+// Chooses who to shed out of the queue and the arriving dispatch w. Needs the
+// lock.
+func (a *admission) victim(strategy ShedStrategy, w *waiter) *waiter {
+	switch strategy {
+	case ShedOldest:
+		return a.waiters.Front().Value.(*waiter)
+	case ShedLowestPriority:
+		victim := w
+		for e := a.waiters.Back(); e != nil; e = e.Prev() {
+			if q := e.Value.(*waiter); q.priority < victim.priority {
+				victim = q
+			}
+		}
+		return victim
+	case ShedByDeadline:
+		victim := w
+		for e := a.waiters.Front(); e != nil; e = e.Next() {
+			q := e.Value.(*waiter)
+			if !q.deadline.IsZero() && (victim.deadline.IsZero() || q.deadline.Before(victim.deadline)) {
+				victim = q
+			}
+		}
+		if victim.deadline.IsZero() || victim.deadline.After(time.Now().Add(a.wait)) {
+			return w
+		}
+		return victim
+	}
+	return w
+}
+
+// Returned by [LoadBalancer.Dispatch] with [Config.ShedUnmeetable] when the
+// chosen handler most likely can't answer before the deadline. Matches
+// [ErrShed] with [errors.Is].
+var ErrDeadlineUnmeetable = fmt.Errorf("%w: deadline can't be met", ErrShed)
+
+// Whether a call to handler i is unlikely to finish before the deadline of
+// ctx, going by its average latency.
+func (s *handlerSet[T, U]) unmeetable(ctx context.Context, i int) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return false
+	}
+	latency := time.Duration(s.ewmaLatency[i].Load())
+	return latency > 0 && time.Until(deadline) < latency
+}
@@ -0,0 +1,178 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a load balancer running one call at a time, with a queue of one,
+// whose handler waits for a value on gate before returning.
+func newGatedBalancer(strategy lb.ShedStrategy) (*lb.LoadBalancer[int, int], chan struct{}) {
+	gate := make(chan struct{})
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-gate
+			return param, nil
+		},
+	})
+	balancer.MaxInFlight = 1
+	balancer.MaxQueue = 1
+	balancer.ShedStrategy = strategy
+	return balancer, gate
+}
+
+// Starts a dispatch in the background and waits until it is running or queued.
+func dispatchAsync(balancer *lb.LoadBalancer[int, int], ctx context.Context) chan error {
+	done := make(chan error, 1)
+	before := balancer.GetQueueStats()
+	go func() {
+		_, err := balancer.Dispatch(ctx, 0)
+		done <- err
+	}()
+	for {
+		now := balancer.GetQueueStats()
+		if now.InFlight > before.InFlight || now.Enqueued > before.Enqueued {
+			return done
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShedNewest(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedNewest)
+	running := dispatchAsync(balancer, context.Background())
+	queued := dispatchAsync(balancer, context.Background())
+
+	_, err := balancer.Dispatch(context.Background(), 0)
+	assert.ErrorIs(t, err, lb.ErrShed)
+
+	gate <- struct{}{}
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	assert.NoError(t, <-queued)
+}
+
+func TestShedOldest(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedOldest)
+	running := dispatchAsync(balancer, context.Background())
+	oldest := dispatchAsync(balancer, context.Background())
+	newest := dispatchAsync(balancer, context.Background())
+
+	assert.ErrorIs(t, <-oldest, lb.ErrShed)
+	gate <- struct{}{}
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	assert.NoError(t, <-newest)
+	assert.Equal(t, int64(1), balancer.GetQueueStats().Dropped)
+}
+
+func TestShedLowestPriority(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedLowestPriority)
+	running := dispatchAsync(balancer, context.Background())
+	normal := dispatchAsync(balancer, lb.WithPriority(context.Background(), 5))
+
+	_, err := balancer.Dispatch(lb.WithPriority(context.Background(), 1), 0)
+	assert.ErrorIs(t, err, lb.ErrShed)
+
+	important := dispatchAsync(balancer, lb.WithPriority(context.Background(), 9))
+	assert.ErrorIs(t, <-normal, lb.ErrShed)
+
+	gate <- struct{}{}
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	assert.NoError(t, <-important)
+}
+
+func TestShedByDeadline(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedByDeadline)
+
+	// Make dispatches wait about 50ms for a slot
+	running := dispatchAsync(balancer, context.Background())
+	queued := dispatchAsync(balancer, context.Background())
+	time.Sleep(50 * time.Millisecond)
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	assert.Eventually(t, func() bool {
+		return balancer.GetQueueStats().Wait >= 50*time.Millisecond
+	}, time.Second, time.Millisecond)
+
+	// Queued is running now. A deadline sooner than the usual wait is
+	// unlikely to be met, so it goes before one without a deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	doomed := dispatchAsync(balancer, ctx)
+	patient := dispatchAsync(balancer, context.Background())
+	assert.ErrorIs(t, <-doomed, lb.ErrShed)
+
+	// A deadline that can be met stays, the newcomer is turned away
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	_, err := balancer.Dispatch(ctx, 0)
+	assert.ErrorIs(t, err, lb.ErrShed)
+
+	gate <- struct{}{}
+	gate <- struct{}{}
+	assert.NoError(t, <-queued)
+	assert.NoError(t, <-patient)
+}
+
+func TestShedUnmeetable(t *testing.T) {
+	calls := 0
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			calls++
+			time.Sleep(20 * time.Millisecond)
+			return param, nil
+		},
+	})
+	balancer.ShedUnmeetable = true
+
+	// Nothing known about the latency yet
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	balancer.Dispatch(ctx, 0)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := balancer.Dispatch(ctx, 0)
+	assert.ErrorIs(t, err, lb.ErrDeadlineUnmeetable)
+	assert.ErrorIs(t, err, lb.ErrShed)
+	assert.Equal(t, 1, calls)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = balancer.Dispatch(ctx, 0)
+	assert.NoError(t, err)
+	_, err = balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestOnShed(t *testing.T) {
+	balancer, unblock, wg := newBlockedBalancer(t, 1)
+	balancer.ShedWhenFull = true
+	balancer.WithFallback(canned(7, nil))
+
+	// Without OnShed the fallbacks take it
+	res, err := balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, res)
+
+	balancer.OnShed = func(ctx context.Context, param int, err error) (int, error) {
+		assert.ErrorIs(t, err, lb.ErrShed)
+		return -param, nil
+	}
+	res, err = balancer.Dispatch(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, -3, res)
+
+	close(unblock)
+	wg.Wait()
+}
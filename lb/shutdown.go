@@ -0,0 +1,101 @@
+package lb
+
+import (
+	"context"
+	"errors"
+)
+
+// Returned by [LoadBalancer.Dispatch] once [LoadBalancer.Shutdown] was called.
+var ErrShuttingDown = errors.New("lb shutting down")
+
+// What happened to the dispatches seen by [LoadBalancer.Shutdown].
+type ShutdownSummary struct {
+	// Dispatches that ran to completion after the shutdown began, whether
+	// they succeeded or not
+	Completed int64 `json:"completed"`
+	// Dispatches turned away after the shutdown began, either shed from the
+	// queue or refused with [ErrShuttingDown]
+	Shed int64 `json:"shed"`
+	// Queued dispatches that gave up waiting, or that were still waiting
+	// when the context of the shutdown ended
+	Cancelled int64 `json:"cancelled"`
+	// Dispatches still running when the context of the shutdown ended
+	Running int `json:"running"`
+}
+
+// Stops the load balancer gracefully. New dispatches fail with
+// [ErrShuttingDown] right away, and the ones already queued under
+// [Config.MaxInFlight] are let through as slots free up, highest priority
+// first (see [WithPriority]). Returns once nothing is left running, then stops
+// the weight updates like [LoadBalancer.Destroy].
+//
+// If ctx ends first, the dispatches still queued fail with [ErrShuttingDown]
+// and the error of ctx is returned along with the summary. Dispatches that
+// are running are left alone. Calling this more than once returns
+// [ErrShuttingDown].
+func (l *LoadBalancer[T, U]) Shutdown(ctx context.Context) (ShutdownSummary, error) {
+	a := &l.admission
+	a.mut.Lock()
+	if a.draining {
+		a.mut.Unlock()
+		return ShutdownSummary{}, ErrShuttingDown
+	}
+	a.draining = true
+	a.idle = make(chan struct{})
+	idle := a.idle
+	a.checkIdle()
+	finished, dropped, cancelled, refused := a.finished, a.dropped, a.cancelled, a.refused
+	a.mut.Unlock()
+
+	var err error
+	select {
+	case <-idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+		a.mut.Lock()
+		for front := a.waiters.Front(); front != nil; front = a.waiters.Front() {
+			a.fail(front.Value.(*waiter), ErrShuttingDown)
+			a.cancelled++
+		}
+		a.mut.Unlock()
+	}
+	l.Destroy()
+
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	summary := ShutdownSummary{
+		Completed: a.finished - finished,
+		Shed:      (a.dropped - a.cancelled) - (dropped - cancelled) + a.refused - refused,
+		Cancelled: a.cancelled - cancelled,
+		Running:   a.inFlight,
+	}
+	return summary, err
+}
+
+// Like [LoadBalancer.Shutdown], for callers that don't need the summary: stops
+// accepting new dispatches, waits for the outstanding ones and returns nil once
+// they are done, or the error of ctx if it ends first.
+func (l *LoadBalancer[T, U]) Close(ctx context.Context) error {
+	_, err := l.Shutdown(ctx)
+	return err
+}
+
+// Returns the waiting dispatch with the highest priority, the oldest among
+// ties, or nil if none. Needs the lock.
+func (a *admission) highestPriority() *waiter {
+	var best *waiter
+	for e := a.waiters.Front(); e != nil; e = e.Next() {
+		if w := e.Value.(*waiter); best == nil || w.priority > best.priority {
+			best = w
+		}
+	}
+	return best
+}
+
+// Signals Shutdown if it is waiting and nothing is left. Needs the lock.
+func (a *admission) checkIdle() {
+	if a.idle != nil && a.inFlight == 0 && a.waiters.Len() == 0 {
+		close(a.idle)
+		a.idle = nil
+	}
+}
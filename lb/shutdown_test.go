@@ -0,0 +1,135 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShutdownIdle(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+	balancer.Start()
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.NoError(t, err)
+
+	summary, err := balancer.Shutdown(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, lb.ShutdownSummary{}, summary)
+
+	_, err = balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrShuttingDown)
+	_, err = balancer.Shutdown(context.Background())
+	assert.ErrorIs(t, err, lb.ErrShuttingDown)
+}
+
+func TestShutdownDrainsByPriority(t *testing.T) {
+	gate := make(chan struct{})
+	var order []int
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-gate
+			order = append(order, param)
+			return param, nil
+		},
+	})
+	balancer.MaxInFlight = 1
+
+	var results []chan error
+	for param, priority := range []int{0, 0, 5, 1} {
+		done := make(chan error, 1)
+		before := balancer.GetQueueStats()
+		go func() {
+			_, err := balancer.Dispatch(lb.WithPriority(context.Background(), priority), param)
+			done <- err
+		}()
+		assert.Eventually(t, func() bool {
+			now := balancer.GetQueueStats()
+			return now.InFlight > before.InFlight || now.Enqueued > before.Enqueued
+		}, time.Second, time.Millisecond)
+		results = append(results, done)
+	}
+
+	type shutdown struct {
+		summary lb.ShutdownSummary
+		err     error
+	}
+	finished := make(chan shutdown, 1)
+	go func() {
+		summary, err := balancer.Shutdown(context.Background())
+		finished <- shutdown{summary, err}
+	}()
+	var refused int64
+	assert.Eventually(t, func() bool {
+		refused++
+		_, err := balancer.Dispatch(context.Background(), -1)
+		return err == lb.ErrShuttingDown
+	}, time.Second, time.Millisecond)
+
+	for range results {
+		gate <- struct{}{}
+	}
+	for _, done := range results {
+		assert.NoError(t, <-done)
+	}
+	res := <-finished
+	assert.NoError(t, res.err)
+	assert.Equal(t, lb.ShutdownSummary{Completed: 4, Shed: refused}, res.summary)
+	assert.Equal(t, []int{0, 2, 3, 1}, order)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	balancer, gate := newGatedBalancer(lb.ShedNewest)
+	running := dispatchAsync(balancer, context.Background())
+	queued := dispatchAsync(balancer, context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	summary, err := balancer.Shutdown(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, lb.ShutdownSummary{Cancelled: 1, Running: 1}, summary)
+	assert.ErrorIs(t, <-queued, lb.ErrShuttingDown)
+
+	gate <- struct{}{}
+	assert.NoError(t, <-running)
+	assert.Equal(t, 0, balancer.GetQueueStats().InFlight)
+}
+
+func TestClose(t *testing.T) {
+	gate := make(chan struct{})
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			<-gate
+			return param, nil
+		},
+	})
+	balancer.Start()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := balancer.Dispatch(context.Background(), 1)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return balancer.GetQueueStats().InFlight == 1
+	}, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, balancer.Close(ctx), context.DeadlineExceeded)
+
+	close(gate)
+	assert.NoError(t, <-done)
+	_, err := balancer.Dispatch(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrShuttingDown)
+	assert.ErrorIs(t, balancer.Close(context.Background()), lb.ErrShuttingDown)
+}
@@ -0,0 +1,197 @@
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The version of the [Snapshot] format written by this version of the library.
+// Newer snapshots can still be read, fields this version doesn't know about are
+// ignored.
+const SnapshotVersion = 1
+
+// What a load balancer has learned about its handlers, enough to start a new
+// one from where it left off, e.g. across restarts. See
+// [LoadBalancer.Snapshot] and [LoadBalancer.Restore].
+type Snapshot struct {
+	Version  int               `json:"version"`
+	Time     time.Time         `json:"time"`
+	Handlers []HandlerSnapshot `json:"handlers"`
+}
+
+// What was learned about a single handler.
+type HandlerSnapshot struct {
+	Name string `json:"name,omitempty"`
+	// Estimated capacity, in tasks per second
+	Capacity float64 `json:"capacity"`
+	// See [HandlerStats.Penalty]
+	Penalty float64 `json:"penalty,omitempty"`
+}
+
+// Encodes and decodes snapshots for storage. Decoders should accept snapshots
+// written by newer versions, ignoring what they don't understand.
+type Codec interface {
+	Encode(w io.Writer, s Snapshot) error
+	Decode(r io.Reader) (Snapshot, error)
+}
+
+// The default [Codec], encoding snapshots as JSON.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(w io.Writer, s Snapshot) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+func (JSONCodec) Decode(r io.Reader) (Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return s, err
+	}
+	if s.Version == 0 {
+		// Written before snapshots were versioned
+		s.Version = 1
+	}
+	return s, nil
+}
+
+// Takes a snapshot of what has been learned about the handlers.
+func (l *LoadBalancer[T, U]) Snapshot() Snapshot {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	s := Snapshot{
+		Version:  SnapshotVersion,
+		Time:     time.Now(),
+		Handlers: make([]HandlerSnapshot, len(l.caps)),
+	}
+	for i := range l.caps {
+		s.Handlers[i] = HandlerSnapshot{
+			Name:     l.names[i],
+			Capacity: l.caps[i],
+			Penalty:  l.penalties[i],
+		}
+	}
+	return s
+}
+
+// What to do with handlers that a snapshot being restored knows nothing about,
+// e.g. because they were added since it was taken.
+type MigrationPolicy int
+
+const (
+	// Keep their current estimate, usually their EstCap.
+	MigrateKeep MigrationPolicy = iota
+	// Start them at the average capacity restored for the other handlers.
+	MigrateAverage
+)
+
+// Options for [LoadBalancer.RestoreWith].
+type RestoreOpts struct {
+	// What to do with handlers missing from the snapshot.
+	Missing MigrationPolicy
+	// If set, called for each handler missing from the snapshot, in order,
+	// with the snapshot's handlers that no handler has claimed yet, e.g. to
+	// match up handlers that were renamed. Return the index of the one to
+	// restore from, or false to apply [RestoreOpts.Missing].
+	Resolve func(name string, unclaimed []HandlerSnapshot) (int, bool)
+}
+
+// Restores what was learned from a snapshot with default options, see
+// [LoadBalancer.RestoreWith].
+func (l *LoadBalancer[T, U]) Restore(s Snapshot) error {
+	return l.RestoreWith(s, RestoreOpts{})
+}
+
+// Restores what was learned from a snapshot and rebalances the weights.
+// Handlers are matched to the snapshot by name, unnamed handlers by position if
+// the snapshot's handler at the same position is unnamed too. Snapshot handlers
+// that match none are dropped, and handlers that match none are dealt with
+// according to opts.
+func (l *LoadBalancer[T, U]) RestoreWith(s Snapshot, opts RestoreOpts) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	claimed := make([]bool, len(s.Handlers))
+	matches := make([]int, len(l.caps))
+	for i, name := range l.names {
+		matches[i] = -1
+		for j, h := range s.Handlers {
+			if claimed[j] || h.Name != name || (name == "" && i != j) {
+				continue
+			}
+			matches[i] = j
+			claimed[j] = true
+			break
+		}
+	}
+
+	if opts.Resolve != nil {
+		for i, name := range l.names {
+			if matches[i] >= 0 {
+				continue
+			}
+			var unclaimed []HandlerSnapshot
+			var indices []int
+			for j, h := range s.Handlers {
+				if !claimed[j] {
+					unclaimed = append(unclaimed, h)
+					indices = append(indices, j)
+				}
+			}
+			k, ok := opts.Resolve(name, unclaimed)
+			if !ok {
+				continue
+			}
+			if k < 0 || k >= len(indices) {
+				return fmt.Errorf("lb resolved handler %q to %d of %d unclaimed handlers", name, k, len(indices))
+			}
+			matches[i] = indices[k]
+			claimed[indices[k]] = true
+		}
+	}
+
+	before := l.auditState()
+	total, restored := 0.0, 0
+	for i, j := range matches {
+		if j < 0 {
+			continue
+		}
+		l.caps[i] = l.clampCap(i, s.Handlers[j].Capacity)
+		l.penalties[i] = min(max(s.Handlers[j].Penalty, 0), 1)
+		total += l.caps[i]
+		restored++
+	}
+	if opts.Missing == MigrateAverage && restored > 0 {
+		for i, j := range matches {
+			if j < 0 {
+				l.caps[i] = l.clampCap(i, total/float64(restored))
+			}
+		}
+	}
+	l.updateWeights()
+	l.record("restore", "", before)
+
+	return nil
+}
+
+// Encodes a snapshot to w, with [JSONCodec] if codec is nil.
+func (l *LoadBalancer[T, U]) SaveSnapshot(w io.Writer, codec Codec) error {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	return codec.Encode(w, l.Snapshot())
+}
+
+// Decodes a snapshot from r, with [JSONCodec] if codec is nil, and restores it.
+func (l *LoadBalancer[T, U]) LoadSnapshot(r io.Reader, codec Codec) error {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	s, err := codec.Decode(r)
+	if err != nil {
+		return err
+	}
+	return l.Restore(s)
+}
@@ -0,0 +1,109 @@
+package lb_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	assert.NoError(t, balancer.SetAllCapacities([]float64{10, 30, 60}))
+
+	var buf bytes.Buffer
+	assert.NoError(t, balancer.SaveSnapshot(&buf, nil))
+
+	restored := lb.NewLoadBalancer(downstreams...)
+	assert.NoError(t, restored.LoadSnapshot(&buf, nil))
+	assert.Equal(t, []float64{10, 30, 60}, restored.GetCapacities())
+	assert.Equal(t, []int{10, 30, 60}, restored.GetWeights())
+}
+
+func TestSnapshotForwardCompatible(t *testing.T) {
+	// A snapshot from a newer version with fields this one doesn't know
+	newer := `{"version": 7, "handlers": [
+		{"capacity": 20, "latency_p99": 5},
+		{"capacity": 80, "region": "eu"}
+	], "strategy": "p2c"}`
+	s, err := lb.JSONCodec{}.Decode(strings.NewReader(newer))
+	assert.NoError(t, err)
+	assert.Equal(t, 7, s.Version)
+
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	assert.NoError(t, balancer.Restore(s))
+	assert.Equal(t, []int{20, 80}, balancer.GetWeights())
+
+	// Unversioned snapshots are version 1
+	s, err = lb.JSONCodec{}.Decode(strings.NewReader(`{"handlers": []}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Version)
+}
+
+func newNamedHandlers(names ...string) []lb.Handler[int, int] {
+	handlers := make([]lb.Handler[int, int], len(names))
+	for i, name := range names {
+		handlers[i] = lb.Handler[int, int]{
+			Name:     name,
+			EstCap:   1,
+			Dispatch: lb.AdaptNoCtx(func(p int) int { return p }),
+		}
+	}
+	return handlers
+}
+
+var oldSnapshot = lb.Snapshot{Handlers: []lb.HandlerSnapshot{
+	{Name: "a", Capacity: 10},
+	{Name: "b", Capacity: 30},
+	{Name: "old-c", Capacity: 60},
+}}
+
+func TestRestoreMatchesByName(t *testing.T) {
+	balancer := lb.NewLoadBalancer(newNamedHandlers("b", "new", "a")...)
+
+	assert.NoError(t, balancer.Restore(oldSnapshot))
+	// The new handler keeps its EstCap, old-c is dropped
+	assert.Equal(t, []float64{30, 1, 10}, balancer.GetCapacities())
+}
+
+func TestRestoreAverage(t *testing.T) {
+	balancer := lb.NewLoadBalancer(newNamedHandlers("b", "new", "a")...)
+
+	err := balancer.RestoreWith(oldSnapshot, lb.RestoreOpts{Missing: lb.MigrateAverage})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{30, 20, 10}, balancer.GetCapacities())
+}
+
+func TestRestoreResolve(t *testing.T) {
+	balancer := lb.NewLoadBalancer(newNamedHandlers("a", "c", "d")...)
+
+	var asked []string
+	err := balancer.RestoreWith(oldSnapshot, lb.RestoreOpts{
+		Missing: lb.MigrateAverage,
+		Resolve: func(name string, unclaimed []lb.HandlerSnapshot) (int, bool) {
+			asked = append(asked, name)
+			for k, h := range unclaimed {
+				if h.Name == "old-"+name {
+					return k, true
+				}
+			}
+			return 0, false
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c", "d"}, asked)
+	// c was renamed from old-c, d gets the average of a and c
+	assert.Equal(t, []float64{10, 60, 35}, balancer.GetCapacities())
+
+	err = balancer.RestoreWith(oldSnapshot, lb.RestoreOpts{
+		Resolve: func(name string, unclaimed []lb.HandlerSnapshot) (int, bool) {
+			return len(unclaimed), true
+		},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,76 @@
+package lb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Dispatches everything received from in and streams back the results, for use
+// as a stage of a channel pipeline. Items are taken from in at the total
+// learned capacity, see [LoadBalancer.Pace], and no more are taken while as
+// many dispatches are running as the handlers can take at once, see
+// [LoadBalancer.Go], or while results aren't being received. So slow handlers
+// or a slow consumer hold up the stages upstream instead of work piling up
+// here.
+//
+// Results come in the order dispatches complete, with the index and name of
+// the handler that served each, or an index of -1 if no handler was called.
+// The channel is closed once in is closed or ctx is done, and every dispatch
+// already started has finished, so keep receiving until then.
+func (l *LoadBalancer[T, U]) Source(ctx context.Context, in <-chan T) <-chan Result[U] {
+	out := make(chan Result[U])
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(out)
+		}()
+
+		var running atomic.Int64
+		freed := make(chan struct{}, 1)
+		for {
+			for running.Load() >= int64(l.parallelism()) {
+				select {
+				case <-freed:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if l.Pace(ctx) != nil {
+				return
+			}
+
+			var param T
+			var ok bool
+			select {
+			case param, ok = <-in:
+			case <-ctx.Done():
+				return
+			}
+			if !ok {
+				return
+			}
+
+			running.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				served := DispatchInfo{Index: -1}
+				res, err := l.DispatchWithOpts(ctx, param, DispatchOpts{
+					onAttempt: func(info DispatchInfo) {
+						served = info
+					},
+				})
+				out <- Result[U]{Index: served.Index, Name: served.Name, Value: res, Err: err}
+
+				running.Add(-1)
+				select {
+				case freed <- struct{}{}:
+				default:
+				}
+			}()
+		}
+	}()
+	return out
+}
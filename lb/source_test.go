@@ -0,0 +1,76 @@
+package lb_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 1000, Dispatch: lb.AdaptNoCtx(func(x int) int { return x * 2 })},
+		lb.Handler[int, int]{Name: "b", EstCap: 1000, Dispatch: lb.AdaptNoCtx(func(x int) int { return x * 2 })},
+	)
+
+	in := make(chan int)
+	go func() {
+		for i := range 20 {
+			in <- i
+		}
+		close(in)
+	}()
+
+	sum := 0
+	names := map[string]int{}
+	for res := range balancer.Source(context.Background(), in) {
+		assert.NoError(t, res.Err)
+		assert.Equal(t, []string{"a", "b"}[res.Index], res.Name)
+		sum += res.Value
+		names[res.Name]++
+	}
+	assert.Equal(t, 380, sum)
+	assert.Equal(t, 20, names["a"]+names["b"])
+}
+
+// Tests that nothing more is taken from the input while results aren't being
+// received.
+func TestSourceBackpressure(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 50,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			time.Sleep(10 * time.Millisecond)
+			return param, nil
+		},
+	})
+	// Learn the latency, so only one call fits at a time
+	balancer.Dispatch(context.Background(), 0)
+
+	var taken atomic.Int32
+	in := make(chan int)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer close(in)
+		for i := 0; ; i++ {
+			select {
+			case in <- i:
+				taken.Add(1)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	out := balancer.Source(ctx, in)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), taken.Load())
+
+	res := <-out
+	assert.Equal(t, 0, res.Value)
+	cancel()
+	for range out {
+	}
+}
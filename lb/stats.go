@@ -0,0 +1,75 @@
+package lb
+
+import "time"
+
+// A snapshot of the state of a single handler.
+type HandlerStats struct {
+	Index int    `json:"index"`
+	Name  string `json:"name,omitempty"`
+	// Current round robin weight
+	Weight int `json:"weight"`
+	// Estimated capacity, in tasks per second
+	Capacity float64 `json:"capacity"`
+	// Number of calls currently running
+	InFlight int `json:"in_flight"`
+	// Exponential moving average of the latency of completed calls, see
+	// [Config.LatencySmoothingFactor]. 0 until a call completes.
+	Latency time.Duration `json:"latency"`
+	// Number of rejected calls sent to another handler instead of waiting
+	// for this one, see [Config.Deflect]
+	Deflections int64 `json:"deflections"`
+	// Share of the weight cut for returning errors, see
+	// [Config.ErrorPenaltyHalfLife]
+	Penalty float64 `json:"penalty"`
+	// Number of calls completed after being sent here by exploration, see
+	// [Config.ExplorationRate]
+	Explorations int64 `json:"explorations"`
+	// Number of those calls that failed
+	ExplorationErrors int64 `json:"exploration_errors"`
+	// Whether the handler only gets exploratory calls until it proves
+	// itself, see [Config.QuarantineCalls]
+	Quarantined bool `json:"quarantined,omitempty"`
+}
+
+// Returns the stats of handler i. Needs the lock.
+func (l *LoadBalancer[T, U]) handlerStats(i int) HandlerStats {
+	return HandlerStats{
+		Index:             i,
+		Name:              l.names[i],
+		Weight:            l.weights[i],
+		Capacity:          l.caps[i],
+		InFlight:          int(l.inFlight[i].Load()),
+		Latency:           time.Duration(l.ewmaLatency[i].Load()),
+		Deflections:       l.deflections[i].Load(),
+		Penalty:           l.penalties[i],
+		Explorations:      l.explorations[i].Load(),
+		ExplorationErrors: l.exploreErrors[i].Load(),
+		Quarantined:       l.quarantined(i),
+	}
+}
+
+// Returns the stats of every handler.
+func (l *LoadBalancer[T, U]) GetStats() []HandlerStats {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	stats := make([]HandlerStats, len(l.caps))
+	for i := range stats {
+		stats[i] = l.handlerStats(i)
+	}
+	return stats
+}
+
+// Folds the latency of a completed call into the moving average of handler i.
+func (s *handlerSet[T, U]) observeLatency(i int, alpha float64, latency time.Duration) {
+	for {
+		old := s.ewmaLatency[i].Load()
+		updated := int64(latency)
+		if old != 0 {
+			updated = int64(alpha*float64(latency) + (1-alpha)*float64(old))
+		}
+		if s.ewmaLatency[i].CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
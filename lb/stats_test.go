@@ -0,0 +1,125 @@
+package lb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsLatency(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	balancer := lb.NewLoadBalancer(lb.Handler[time.Duration, int]{
+		Name:   "sleepy",
+		EstCap: 2,
+		Dispatch: func(ctx context.Context, param time.Duration) (int, error) {
+			if param == 0 {
+				started <- struct{}{}
+				<-release
+			}
+			time.Sleep(param)
+			return 0, nil
+		},
+	})
+	balancer.LatencySmoothingFactor = 0.5
+
+	stats := balancer.GetStats()
+	assert.Equal(t, "sleepy", stats[0].Name)
+	assert.Equal(t, 2.0, stats[0].Capacity)
+	assert.Equal(t, time.Duration(0), stats[0].Latency)
+
+	go balancer.Dispatch(context.Background(), 0)
+	<-started
+	assert.Equal(t, 1, balancer.GetStats()[0].InFlight)
+	release <- struct{}{}
+
+	balancer.Dispatch(context.Background(), 20*time.Millisecond)
+	balancer.Dispatch(context.Background(), 40*time.Millisecond)
+	stats = balancer.GetStats()
+	assert.Equal(t, 0, stats[0].InFlight)
+	// roughly halfway between the two, with the first call's tiny latency
+	// mixed in
+	assert.InDelta(t, 25*time.Millisecond, stats[0].Latency, float64(10*time.Millisecond))
+}
+
+func TestExplorationStats(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1000, 1000)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.ErrorPenaltyHalfLife = time.Second
+	balancer.ExcludeExplorationErrors = true
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		assert.Equal(t, param == 1, info.Explore)
+		if index == 1 {
+			return 0, errors.New("broken")
+		}
+		return param, nil
+	}
+
+	balancer.ExplorationRate = 1
+	for range 10 {
+		balancer.Dispatch(context.Background(), 1)
+	}
+	balancer.TickOnce()
+	stats := balancer.GetStats()
+	assert.Equal(t, int64(10), stats[0].Explorations+stats[1].Explorations)
+	assert.Equal(t, stats[1].Explorations, stats[1].ExplorationErrors)
+	assert.Positive(t, stats[1].ExplorationErrors)
+	assert.Zero(t, stats[1].Penalty)
+
+	// Errors from regular calls still count
+	balancer.ExplorationRate = 0
+	for range 10 {
+		balancer.Dispatch(context.Background(), 0)
+	}
+	balancer.TickOnce()
+	stats = balancer.GetStats()
+	assert.Equal(t, int64(10), stats[0].Explorations+stats[1].Explorations)
+	assert.Positive(t, stats[1].Penalty)
+}
+
+// Records the samples it is given instead of estimating anything.
+type sampleRecorder struct {
+	samples *[]lb.Sample
+}
+
+func (r sampleRecorder) Estimate(c *lb.Config, capacity float64, s lb.Sample) float64 {
+	*r.samples = append(*r.samples, s)
+	return capacity
+}
+
+// Tests that excluded exploration errors don't pass for goodput.
+func TestExplorationErrorsNotGoodput(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1000, 1000)
+	balancer := lb.NewLoadBalancer(downstreams...)
+	balancer.WeightByGoodput = true
+	balancer.ExcludeExplorationErrors = true
+	balancer.ExplorationRate = 1
+	balancer.DryRun = func(ctx context.Context, index int, param int) (int, error) {
+		if index == 1 {
+			return 0, errors.New("broken")
+		}
+		return param, nil
+	}
+	samples := make([][]lb.Sample, 2)
+	created := 0
+	balancer.Estimator = func() lb.Estimator {
+		created++
+		return sampleRecorder{&samples[created-1]}
+	}
+
+	for range 20 {
+		balancer.Dispatch(context.Background(), 1)
+	}
+	balancer.TickOnce()
+	stats := balancer.GetStats()
+	assert.Positive(t, stats[1].ExplorationErrors)
+	assert.Positive(t, samples[0][0].Calls)
+	assert.Zero(t, samples[1][0].Calls)
+	assert.Zero(t, samples[1][0].Errors)
+}
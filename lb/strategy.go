@@ -0,0 +1,99 @@
+package lb
+
+import "github.com/podocarp/dynlb-go/internal/rr"
+
+// Chooses the handler for each dispatch from the weights the load balancer
+// learned, see [LoadBalancer.SetStrategy]. Methods are called with the load
+// balancer's lock held, so implementations need no locking of their own.
+type Strategy interface {
+	// Called with the current weights, one per handler and summing to
+	// [Config.WeightScale], when the strategy is installed and every time
+	// they change. The slice must not be modified.
+	SetWeights(weights []int)
+	// Returns the next handler to use, passing over those for which usable
+	// returns false. Returns false if it found nothing usable, the load
+	// balancer then looks for a usable handler itself.
+	Next(usable func(index int) bool) (int, bool)
+}
+
+// Optionally implemented by a [Strategy] that can take over state from the
+// one it replaces, e.g. to keep statistics it learned instead of starting cold.
+type StrategyHandoff interface {
+	// Called by [LoadBalancer.SetStrategy] before the strategy is installed,
+	// with the strategy it replaces.
+	Handoff(prev Strategy)
+}
+
+// Optionally implemented by a [Strategy] to expose its internals for
+// troubleshooting, e.g. the arms of a bandit or the layout of a hash ring. The
+// result is included in [LoadBalancer.MarshalJSON] and must marshal to JSON.
+type StrategyDebugger interface {
+	DebugState() any
+}
+
+// Optionally implemented by a [Strategy] that goes by how busy each handler is,
+// e.g. [LeastOutstanding].
+type StrategyInFlight interface {
+	// Called by [LoadBalancer.SetStrategy] before the strategy is installed,
+	// with a function returning the number of calls currently running on a
+	// handler. It may only be called from Next.
+	SetInFlight(inFlight func(index int) int)
+}
+
+// The built in strategy, selecting from the embedded round robin.
+type wrrStrategy struct {
+	*rr.WeightedRoundRobin
+}
+
+// Nothing to do, the load balancer updates the round robin itself.
+func (s wrrStrategy) SetWeights(weights []int) {}
+
+func (s wrrStrategy) Next(usable func(index int) bool) (int, bool) {
+	// Handlers out of quota have no weight, but if everyone has no weight
+	// the scheduler falls back to a plain round robin so check anyway.
+	for range len(s.GetWeights()) {
+		index := s.Peek()
+		if usable(index) {
+			return s.Dispatch(), true
+		}
+		s.Skip(index)
+	}
+	return 0, false
+}
+
+// Replaces the strategy used to choose handlers, taking effect from the next
+// dispatch. The learned weights carry over, and if s implements
+// [StrategyHandoff] it is handed the strategy it replaces. nil goes back to the
+// built in interleaved weighted round robin. Exploration, see
+// [Config.ExplorationRate], happens regardless of the strategy.
+func (l *LoadBalancer[T, U]) SetStrategy(s Strategy) {
+	if s == nil {
+		s = wrrStrategy{l.WeightedRoundRobin}
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	before := l.auditState()
+	if h, ok := s.(StrategyHandoff); ok {
+		h.Handoff(l.strategy)
+	}
+	if f, ok := s.(StrategyInFlight); ok {
+		f.SetInFlight(l.inFlightOf)
+	}
+	s.SetWeights(l.WeightedRoundRobin.GetWeights())
+	l.strategy = s
+	l.record("set_strategy", "", before)
+}
+
+// Returns the number of calls running on handler i of the installed set. Needs
+// the lock.
+func (l *LoadBalancer[T, U]) inFlightOf(i int) int {
+	return int(l.inFlight[i].Load())
+}
+
+// Returns the strategy currently used to choose handlers.
+func (l *LoadBalancer[T, U]) GetStrategy() Strategy {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.strategy
+}
@@ -0,0 +1,96 @@
+package lb_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Always picks the usable handler with the highest weight.
+type heaviest struct {
+	weights []int
+	prev    lb.Strategy
+}
+
+func (h *heaviest) SetWeights(weights []int) {
+	h.weights = weights
+}
+
+func (h *heaviest) Next(usable func(index int) bool) (int, bool) {
+	best := -1
+	for i, w := range h.weights {
+		if usable(i) && (best < 0 || w > h.weights[best]) {
+			best = i
+		}
+	}
+	return best, best >= 0
+}
+
+func (h *heaviest) Handoff(prev lb.Strategy) {
+	h.prev = prev
+}
+
+func (h *heaviest) DebugState() any {
+	return map[string]any{"weights": h.weights}
+}
+
+func TestSetStrategy(t *testing.T) {
+	var chosen []int
+	handler := func(ctx context.Context, param int) (int, error) {
+		info, _ := lb.DispatchInfoFromContext(ctx)
+		chosen = append(chosen, info.Index)
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10, Dispatch: handler},
+		lb.Handler[int, int]{EstCap: 30, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+	builtin := balancer.GetStrategy()
+
+	strategy := &heaviest{}
+	balancer.SetStrategy(strategy)
+	assert.Equal(t, builtin, strategy.prev)
+	assert.Equal(t, []int{25, 75}, strategy.weights)
+	assert.Equal(t, lb.Strategy(strategy), balancer.GetStrategy())
+	for i := range 3 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Equal(t, []int{1, 1, 1}, chosen)
+
+	// Weight changes reach the strategy
+	balancer.SetAllCapacities([]float64{30, 10})
+	assert.Equal(t, []int{75, 25}, strategy.weights)
+	balancer.Dispatch(context.Background(), 0)
+	assert.Equal(t, 0, chosen[3])
+
+	balancer.SetStrategy(nil)
+	chosen = nil
+	balancer.SetAllCapacities([]float64{10, 10})
+	for i := range 4 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.ElementsMatch(t, []int{0, 1, 0, 1}, chosen)
+}
+
+func TestStrategyDebugState(t *testing.T) {
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{EstCap: 10},
+		lb.Handler[int, int]{EstCap: 30},
+	)
+
+	var dump map[string]any
+	data, err := json.Marshal(balancer)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &dump))
+	assert.NotContains(t, dump, "strategy")
+
+	balancer.SetStrategy(&heaviest{})
+	data, err = json.Marshal(balancer)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &dump))
+	assert.Equal(t, map[string]any{"weights": []any{25.0, 75.0}}, dump["strategy"])
+}
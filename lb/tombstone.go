@@ -0,0 +1,71 @@
+package lb
+
+import "slices"
+
+// What is kept of a removed handler, see [LoadBalancer.RemovedStats].
+type tombstone struct {
+	stats     HandlerStats
+	estimator Estimator
+}
+
+// Keeps the final stats of handler i of the installed set, which is being
+// removed. [LoadBalancer.trimTombstones] must be called once the set without it is
+// installed. Needs the lock.
+func (l *LoadBalancer[T, U]) bury(i int) {
+	l.tombstones = append(l.tombstones, tombstone{
+		stats:     l.handlerStats(i),
+		estimator: l.estimators[i],
+	})
+}
+
+// Drops the tombstones of the handlers removed longest ago until there are
+// at most [Config.TombstoneSize] and, with the handlers installed, at most
+// [Config.MaxTrackedHandlers]. Needs the lock.
+func (l *LoadBalancer[T, U]) trimTombstones() {
+	keep := max(l.TombstoneSize, 0)
+	if l.MaxTrackedHandlers > 0 {
+		keep = min(keep, max(l.MaxTrackedHandlers-len(l.ids), 0))
+	}
+	if over := len(l.tombstones) - keep; over > 0 {
+		l.tombstones = slices.Delete(l.tombstones, 0, over)
+	}
+	if len(l.tombstones) == 0 {
+		l.tombstones = nil
+	}
+}
+
+// Gives handler i of s, which was just added, the estimates of the last
+// removed handler with the same name if it was kept, so a backend coming back
+// picks up where it left off. Needs the lock.
+func (l *LoadBalancer[T, U]) resurrect(s *handlerSet[T, U], i int) {
+	if s.names[i] == "" {
+		return
+	}
+	for k := len(l.tombstones) - 1; k >= 0; k-- {
+		t := l.tombstones[k]
+		if t.stats.Name != s.names[i] {
+			continue
+		}
+		l.tombstones = slices.Delete(l.tombstones, k, k+1)
+		s.caps[i] = s.clampCap(i, t.stats.Capacity)
+		s.penalties[i] = t.stats.Penalty
+		s.estimators[i] = t.estimator
+		s.ewmaLatency[i].Store(int64(t.stats.Latency))
+		return
+	}
+}
+
+// Returns the stats of the last few removed handlers as of their removal,
+// removed longest ago first, so their counters don't just vanish from
+// dashboards. See [Config.TombstoneSize]. A handler added back under the same
+// [Handler.Name] resumes from its estimates and leaves this list.
+func (l *LoadBalancer[T, U]) RemovedStats() []HandlerStats {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	stats := make([]HandlerStats, len(l.tombstones))
+	for i, t := range l.tombstones {
+		stats[i] = t.stats
+	}
+	return stats
+}
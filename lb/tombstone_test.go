@@ -0,0 +1,103 @@
+package lb_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemovedStats(t *testing.T) {
+	handler := func(name string) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			Name:   name,
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				return param, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler("a"), handler("b"), handler("c"))
+	balancer.ExplorationRate = 0
+	balancer.SetAllCapacities([]float64{30, 20, 10})
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+
+	balancer.RemoveHandler(0)
+	removed := balancer.RemovedStats()
+	if assert.Len(t, removed, 1) {
+		assert.Equal(t, "a", removed[0].Name)
+		assert.Equal(t, 30.0, removed[0].Capacity)
+		assert.Equal(t, 50, removed[0].Weight)
+	}
+
+	// Coming back resumes from the old estimate
+	balancer.AddHandler(handler("a"))
+	assert.Equal(t, []float64{20, 10, 30}, balancer.GetCapacities())
+	assert.Empty(t, balancer.RemovedStats())
+
+	// Only the most recently removed are kept
+	balancer.TombstoneSize = 2
+	balancer.SetHandlers([]lb.Handler[int, int]{handler("d")})
+	var names []string
+	for _, stats := range balancer.RemovedStats() {
+		names = append(names, stats.Name)
+	}
+	assert.Equal(t, []string{"c", "a"}, names)
+}
+
+func TestMaxTrackedHandlers(t *testing.T) {
+	handler := func(name string) lb.Handler[int, int] {
+		return lb.Handler[int, int]{
+			Name:   name,
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				return param, nil
+			},
+		}
+	}
+	balancer := lb.NewLoadBalancer(handler("a"), handler("b"), handler("c"))
+	balancer.MaxTrackedHandlers = 5
+	balancer.AffinityKey = func(param int) (string, bool) {
+		return fmt.Sprint(param), true
+	}
+
+	// Handlers come and go under new names, e.g. pods being replaced
+	churn := func(from, to int) {
+		for i := from; i < to; i++ {
+			balancer.AddHandler(handler(fmt.Sprint("pod-", i)))
+			balancer.Dispatch(context.Background(), i)
+			balancer.RemoveHandler(3)
+		}
+	}
+	heap := func() uint64 {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	churn(0, 1000)
+	removed := balancer.RemovedStats()
+	if assert.Len(t, removed, 2) {
+		// Those removed longest ago are dropped first
+		assert.Equal(t, "pod-998", removed[0].Name)
+		assert.Equal(t, "pod-999", removed[1].Name)
+	}
+	before := heap()
+	churn(1000, 11000)
+	assert.Len(t, balancer.RemovedStats(), 2)
+	assert.Less(t, int64(heap())-int64(before), int64(1<<20))
+
+	// Handlers installed are never dropped
+	balancer.SetHandlers([]lb.Handler[int, int]{
+		handler("a"), handler("b"), handler("c"), handler("d"),
+		handler("e"), handler("f"),
+	})
+	assert.Len(t, balancer.GetCapacities(), 6)
+	assert.Empty(t, balancer.RemovedStats())
+}
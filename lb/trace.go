@@ -0,0 +1,38 @@
+package lb
+
+import (
+	"fmt"
+	"time"
+)
+
+// A single attempt on a handler being traced, see [LoadBalancer.Trace].
+type TraceEvent struct {
+	Time    time.Time
+	Index   int
+	Name    string
+	Outcome Outcome
+	Latency time.Duration
+	// The error the handler returned, if any
+	Err error
+}
+
+// Passes every attempt on the handler with the given name (the first, if
+// several share it) to [Config.OnTrace] for the given duration, e.g. from an
+// admin endpoint while debugging a single handler in production. Tracing a
+// handler again extends or shortens its trace, a duration of 0 stops it.
+func (l *LoadBalancer[T, U]) Trace(name string, d time.Duration) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	for i, n := range l.names {
+		if n == name {
+			l.traceUntil[i].Store(time.Now().Add(d).UnixNano())
+			return nil
+		}
+	}
+	return fmt.Errorf("lb has no handler named %q", name)
+}
+
+// Whether attempts on handler i are being traced.
+func (s *handlerSet[T, U]) tracing(i int, now time.Time) bool {
+	return now.UnixNano() < s.traceUntil[i].Load()
+}
@@ -0,0 +1,54 @@
+package lb_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+	handler := func(ctx context.Context, param int) (int, error) {
+		return param, nil
+	}
+	balancer := lb.NewLoadBalancer(
+		lb.Handler[int, int]{Name: "a", EstCap: 1, Dispatch: handler},
+		lb.Handler[int, int]{Name: "b", EstCap: 1, Dispatch: handler},
+	)
+	balancer.ExplorationRate = 0
+
+	var mut sync.Mutex
+	var events []lb.TraceEvent
+	balancer.OnTrace = func(e lb.TraceEvent) {
+		mut.Lock()
+		defer mut.Unlock()
+		events = append(events, e)
+	}
+
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Empty(t, events)
+
+	assert.NoError(t, balancer.Trace("b", time.Minute))
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Len(t, events, 5)
+	for _, e := range events {
+		assert.Equal(t, "b", e.Name)
+		assert.Equal(t, 1, e.Index)
+		assert.Equal(t, lb.OutcomeSuccess, e.Outcome)
+	}
+
+	assert.NoError(t, balancer.Trace("b", 0))
+	for i := range 10 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.Len(t, events, 5)
+
+	assert.Error(t, balancer.Trace("c", time.Minute))
+}
@@ -0,0 +1,114 @@
+package lb
+
+import (
+	"context"
+	"time"
+)
+
+// Balances traffic over clusters, then over the handlers within the chosen
+// cluster, e.g. picking a region then a host in it. Each cluster is load
+// balanced by its own [LoadBalancer], and a cluster level [LoadBalancer]
+// chooses between them in proportion to their total estimated capacity.
+//
+// Only the cluster's load balancer backs off and retries on [ErrExceedCap],
+// the cluster level one just sees the outcome, so a dispatch is never retried
+// at both levels.
+type TwoLevel[T any, U any] struct {
+	// How often the capacities of the clusters are rolled up.
+	UpdateInterval time.Duration
+
+	top      *LoadBalancer[T, U]
+	clusters []*LoadBalancer[T, U]
+	done     chan struct{}
+}
+
+func NewTwoLevel[T any, U any](clusters ...Cluster[T, U]) *TwoLevel[T, U] {
+	t := &TwoLevel[T, U]{
+		UpdateInterval: time.Second,
+		clusters:       make([]*LoadBalancer[T, U], len(clusters)),
+		done:           make(chan struct{}, 1),
+	}
+	handlers := make([]Handler[T, U], len(clusters))
+	for i, c := range clusters {
+		inner := NewLoadBalancer(c.Handlers...)
+		t.clusters[i] = inner
+		handlers[i] = Handler[T, U]{
+			Name:     c.Name,
+			EstCap:   inner.totalCapacity(),
+			Dispatch: inner.Dispatch,
+			Data:     inner,
+		}
+	}
+	t.top = NewLoadBalancer(handlers...)
+	return t
+}
+
+// Returns the cluster level load balancer, e.g. to tune its [Config]. Its
+// capacities are rolled up from the clusters rather than learned, so it is
+// never started.
+func (t *TwoLevel[T, U]) Top() *LoadBalancer[T, U] {
+	return t.top
+}
+
+// Returns the load balancer of cluster i, in the order given to
+// [NewTwoLevel].
+func (t *TwoLevel[T, U]) Cluster(i int) *LoadBalancer[T, U] {
+	return t.clusters[i]
+}
+
+func (t *TwoLevel[T, U]) spin() {
+	ticker := time.NewTicker(t.UpdateInterval)
+	for {
+		select {
+		case <-ticker.C:
+			t.Update()
+		case <-t.done:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// Sets the capacity of every cluster in the cluster level load balancer to the
+// total estimated capacity of its handlers. Runs every
+// [TwoLevel.UpdateInterval] once started.
+func (t *TwoLevel[T, U]) Update() {
+	caps := make([]float64, len(t.clusters))
+	for i, c := range t.clusters {
+		caps[i] = c.totalCapacity()
+	}
+	// Not a change worth auditing, it happens every interval
+	t.top.mut.Lock()
+	t.top.setCapacities(caps)
+	t.top.mut.Unlock()
+}
+
+// Starts every cluster's load balancer and the capacity roll up.
+func (t *TwoLevel[T, U]) Start() {
+	for _, c := range t.clusters {
+		c.Start()
+	}
+	go t.spin()
+}
+
+// Stops every cluster's load balancer and the capacity roll up.
+func (t *TwoLevel[T, U]) Destroy() {
+	for _, c := range t.clusters {
+		c.Destroy()
+	}
+	t.done <- struct{}{}
+}
+
+// Dispatches to a handler of one of the clusters. If every handler of a
+// cluster is out of quota, the cluster is skipped until one comes back.
+func (t *TwoLevel[T, U]) Dispatch(ctx context.Context, param T) (U, error) {
+	return t.top.Dispatch(ctx, param)
+}
+
+// Returns the sum of the estimated capacities of the handlers that can take
+// calls right now.
+func (l *LoadBalancer[T, U]) totalCapacity() float64 {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.totalCap
+}
@@ -0,0 +1,111 @@
+package lb_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func returns(value int, estCap float64) lb.Handler[int, int] {
+	return lb.Handler[int, int]{
+		EstCap: estCap,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return value, nil
+		},
+	}
+}
+
+func TestTwoLevel(t *testing.T) {
+	balancer := lb.NewTwoLevel(
+		lb.Cluster[int, int]{Name: "east", Handlers: []lb.Handler[int, int]{returns(1, 10), returns(2, 10)}},
+		lb.Cluster[int, int]{Name: "west", Handlers: []lb.Handler[int, int]{returns(3, 60)}},
+	)
+	balancer.Top().ExplorationRate = 0
+	balancer.Cluster(0).ExplorationRate = 0
+	assert.Equal(t, []float64{20, 60}, balancer.Top().GetCapacities())
+	assert.Equal(t, []int{25, 75}, balancer.Top().GetWeights())
+
+	counts := map[int]int{}
+	for range 100 {
+		res, err := balancer.Dispatch(context.Background(), 0)
+		assert.NoError(t, err)
+		counts[res]++
+	}
+	assert.Equal(t, map[int]int{1: 13, 2: 12, 3: 75}, counts)
+
+	// Capacity learned inside a cluster rolls up
+	balancer.Cluster(0).SetAllCapacities([]float64{30, 30})
+	balancer.Update()
+	assert.Equal(t, []float64{60, 60}, balancer.Top().GetCapacities())
+}
+
+// Tests that a cluster whose handlers are all out of quota is skipped.
+func TestTwoLevelClusterExhausted(t *testing.T) {
+	exhausted := lb.Handler[int, int]{
+		EstCap: 10,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, &lb.QuotaExhaustedError{Reset: time.Now().Add(time.Minute)}
+		},
+	}
+	balancer := lb.NewTwoLevel(
+		lb.Cluster[int, int]{Name: "east", Handlers: []lb.Handler[int, int]{exhausted}},
+		lb.Cluster[int, int]{Name: "west", Handlers: []lb.Handler[int, int]{returns(3, 10)}},
+	)
+	balancer.Top().ExplorationRate = 0
+
+	for range 4 {
+		res, err := balancer.Dispatch(context.Background(), 0)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, res)
+	}
+	balancer.Update()
+	assert.Equal(t, []int{0, 100}, balancer.Top().GetWeights())
+}
+
+// Tests that a cluster out of quota comes back when its handlers do, not after
+// QuotaResetAfter.
+func TestTwoLevelClusterQuotaReset(t *testing.T) {
+	reset := time.Now().Add(50 * time.Millisecond)
+	var calls atomic.Int32
+	balancer := lb.NewTwoLevel(lb.Cluster[int, int]{
+		Name: "east",
+		Handlers: []lb.Handler[int, int]{{
+			EstCap: 10,
+			Dispatch: func(ctx context.Context, param int) (int, error) {
+				if calls.Add(1) == 1 {
+					return 0, &lb.QuotaExhaustedError{Reset: reset}
+				}
+				return 1, nil
+			},
+		}},
+	})
+
+	_, err := balancer.Dispatch(context.Background(), 0)
+	var quotaErr *lb.QuotaExhaustedError
+	if assert.ErrorAs(t, err, &quotaErr) {
+		assert.True(t, quotaErr.Reset.Equal(reset))
+	}
+
+	time.Sleep(time.Until(reset))
+	res, err := balancer.Dispatch(context.Background(), 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res)
+}
+
+func TestTwoLevelStart(t *testing.T) {
+	balancer := lb.NewTwoLevel(
+		lb.Cluster[int, int]{Name: "east", Handlers: []lb.Handler[int, int]{returns(1, 10)}},
+	)
+	balancer.UpdateInterval = 10 * time.Millisecond
+	balancer.Start()
+	defer balancer.Destroy()
+
+	balancer.Cluster(0).SetAllCapacities([]float64{40})
+	assert.Eventually(t, func() bool {
+		return balancer.Top().GetCapacities()[0] == 40
+	}, time.Second, 5*time.Millisecond)
+}
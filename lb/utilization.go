@@ -0,0 +1,54 @@
+package lb
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// Returns the fraction of capacity handlers are paced to, 1 if not paced.
+func (l *LoadBalancer[T, U]) utilization() float64 {
+	if l.TargetUtilization <= 0 || l.TargetUtilization >= 1 {
+		return 1
+	}
+	return l.TargetUtilization
+}
+
+// Paces each handler to [Config.TargetUtilization] of its current capacity, and
+// callers of [LoadBalancer.Pace] to that of the total capacity. Needs the lock.
+func (l *LoadBalancer[T, U]) pace() {
+	u := l.utilization()
+	l.producer.SetLimit(rate.Limit(l.totalCap * u))
+	for i, pacer := range l.pacers {
+		if u < 1 {
+			pacer.SetLimit(rate.Limit(l.caps[i] * u))
+		} else {
+			pacer.SetLimit(rate.Inf)
+		}
+	}
+}
+
+// Blocks until the handlers are estimated to have room for one more call, or
+// ctx is done. Calls are let through at the total estimated capacity (times
+// [Config.TargetUtilization] if set), so a loop producing work can call this
+// before each item to produce exactly as fast as the handlers can consume.
+// Doesn't dispatch anything or reserve capacity for a later dispatch. While no
+// handler has any capacity, e.g. all are out of quota, it waits for some to
+// come back.
+func (l *LoadBalancer[T, U]) Pace(ctx context.Context) error {
+	for {
+		l.mut.Lock()
+		changed := l.changed
+		idle := l.totalCap <= 0
+		l.mut.Unlock()
+		if !idle {
+			return l.producer.Wait(ctx)
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
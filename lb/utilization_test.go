@@ -0,0 +1,74 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEchoBalancer() *lb.LoadBalancer[int, int] {
+	return lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return param, nil
+		},
+	})
+}
+
+func TestTargetUtilizationPaces(t *testing.T) {
+	balancer := newEchoBalancer()
+	balancer.TargetUtilization = 0.5
+	assert.NoError(t, balancer.SetAllCapacities([]float64{100}))
+
+	// 50 per second, the first call goes through immediately
+	start := time.Now()
+	for i := range 6 {
+		balancer.Dispatch(context.Background(), i)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestTargetUtilizationScalesEstimate(t *testing.T) {
+	paced := newEchoBalancer()
+	paced.TargetUtilization = 0.5
+	unpaced := newEchoBalancer()
+	for _, balancer := range []*lb.LoadBalancer[int, int]{paced, unpaced} {
+		assert.NoError(t, balancer.SetAllCapacities([]float64{1000}))
+		for i := range 10 {
+			balancer.Dispatch(context.Background(), i)
+		}
+		balancer.TickOnce()
+	}
+
+	// Twice the observed rate is folded into the paced estimate
+	assert.Greater(t, paced.GetCapacities()[0], unpaced.GetCapacities()[0])
+}
+
+func TestPace(t *testing.T) {
+	balancer := newEchoBalancer()
+	assert.NoError(t, balancer.SetAllCapacities([]float64{50}))
+
+	// 50 per second, the first call goes through immediately
+	start := time.Now()
+	for range 6 {
+		assert.NoError(t, balancer.Pace(context.Background()))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestPaceWaitsForCapacity(t *testing.T) {
+	balancer := lb.NewLoadBalancer(lb.Handler[int, int]{
+		EstCap: 1,
+		Dispatch: func(ctx context.Context, param int) (int, error) {
+			return 0, &lb.QuotaExhaustedError{Reset: time.Now().Add(time.Hour)}
+		},
+	})
+	balancer.Dispatch(context.Background(), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, balancer.Pace(ctx), context.DeadlineExceeded)
+}
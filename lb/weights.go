@@ -0,0 +1,102 @@
+package lb
+
+import (
+	"math"
+	"slices"
+)
+
+// Splits total into integer parts proportional to shares using the largest
+// remainder method: everyone gets the floor of their exact quota, and whatever
+// is left over goes one by one to the largest fractional parts, ties going to
+// the lower index. Unlike truncating each quota, the result always sums to
+// total (as long as some share is positive) and doesn't systematically
+// shortchange small shares.
+func apportion(shares []float64, total int) []int {
+	res := make([]int, len(shares))
+	sum := 0.0
+	for _, s := range shares {
+		sum += max(s, 0)
+	}
+	if sum <= 0 || total <= 0 {
+		return res
+	}
+
+	remainders := make([]float64, len(shares))
+	left := total
+	for i, s := range shares {
+		quota := max(s, 0) / sum * float64(total)
+		res[i] = int(math.Floor(quota))
+		remainders[i] = quota - float64(res[i])
+		left -= res[i]
+	}
+
+	order := make([]int, len(shares))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		switch {
+		case remainders[a] > remainders[b]:
+			return -1
+		case remainders[a] < remainders[b]:
+			return 1
+		}
+		return 0
+	})
+	for _, i := range order[:min(left, len(order))] {
+		res[i]++
+	}
+
+	return res
+}
+
+// Turns the capacities into round robin weights, with [Config.WeightFunc] if
+// set. Needs the lock.
+func (l *LoadBalancer[T, U]) weigh(caps []float64) []int {
+	if l.WeightFunc == nil {
+		return apportion(caps, l.WeightScale)
+	}
+
+	stats := make([]HandlerStats, len(caps))
+	for i := range stats {
+		stats[i] = l.handlerStats(i)
+	}
+	weights := l.WeightFunc(slices.Clone(caps), stats)
+	if len(weights) != len(caps) {
+		return apportion(caps, l.WeightScale)
+	}
+	for i, w := range weights {
+		weights[i] = max(w, 0)
+	}
+	return weights
+}
+
+// Returns a [Config.WeightFunc] that gives handlers weights out of scale in
+// proportion to exp(c / (max * temperature)), where c is their capacity and max
+// the largest capacity. Low temperatures send most traffic to the largest
+// handlers, high temperatures spread it nearly uniformly. A temperature of 0 or
+// less is the limit of that, sending all traffic to the largest handlers.
+// Handlers with no capacity, e.g. out of quota, get no weight.
+func Softmax(temperature float64, scale int) func(caps []float64, stats []HandlerStats) []int {
+	return func(caps []float64, stats []HandlerStats) []int {
+		largest := 0.0
+		for _, c := range caps {
+			largest = max(largest, c)
+		}
+		shares := make([]float64, len(caps))
+		if largest <= 0 {
+			return apportion(shares, scale)
+		}
+		for i, c := range caps {
+			if temperature <= 0 {
+				if c == largest {
+					shares[i] = 1
+				}
+			} else if c > 0 {
+				// Relative to the largest so the exponent is at most 0
+				shares[i] = math.Exp((c/largest - 1) / temperature)
+			}
+		}
+		return apportion(shares, scale)
+	}
+}
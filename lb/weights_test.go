@@ -0,0 +1,70 @@
+package lb_test
+
+import (
+	"testing"
+
+	"github.com/podocarp/dynlb-go/internal/utils"
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightFunc(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+
+	var gotCaps []float64
+	var gotStats []lb.HandlerStats
+	balancer.WeightFunc = func(caps []float64, stats []lb.HandlerStats) []int {
+		gotCaps, gotStats = caps, stats
+		// Everyone with any capacity gets the same weight
+		weights := make([]int, len(caps))
+		for i, c := range caps {
+			if c > 0 {
+				weights[i] = 1
+			}
+		}
+		return weights
+	}
+
+	assert.NoError(t, balancer.SetAllCapacities([]float64{10, 30, 60}))
+	assert.Equal(t, []int{1, 1, 1}, balancer.GetWeights())
+	assert.Equal(t, []float64{10, 30, 60}, gotCaps)
+	assert.Len(t, gotStats, 3)
+	assert.Equal(t, 2, gotStats[2].Index)
+	assert.Equal(t, 60.0, gotStats[2].Capacity)
+}
+
+func TestWeightFuncBadResult(t *testing.T) {
+	downstreams := utils.NewRateLimitedDownstreams(1, 1)
+	balancer := lb.NewLoadBalancer(downstreams...)
+
+	balancer.WeightFunc = func(caps []float64, stats []lb.HandlerStats) []int {
+		return []int{1}
+	}
+	assert.NoError(t, balancer.SetAllCapacities([]float64{25, 75}))
+	assert.Equal(t, []int{25, 75}, balancer.GetWeights())
+
+	balancer.WeightFunc = func(caps []float64, stats []lb.HandlerStats) []int {
+		return []int{-5, 3}
+	}
+	assert.NoError(t, balancer.SetAllCapacities([]float64{25, 75}))
+	assert.Equal(t, []int{0, 3}, balancer.GetWeights())
+}
+
+func TestSoftmax(t *testing.T) {
+	caps := []float64{10, 90, 0}
+
+	// Nearly uniform between the handlers with capacity
+	assert.Equal(t, []int{50, 50, 0}, lb.Softmax(1000, 100)(caps, nil))
+	// The larger handler takes nearly everything
+	assert.Equal(t, []int{0, 100, 0}, lb.Softmax(0.01, 100)(caps, nil))
+	// e^(10/90 - 1) : 1
+	assert.Equal(t, []int{29, 71, 0}, lb.Softmax(1, 100)(caps, nil))
+	// No temperature is the limit, the largest takes everything
+	assert.Equal(t, []int{0, 100, 0}, lb.Softmax(0, 100)(caps, nil))
+	assert.Equal(t, []int{0, 100, 0}, lb.Softmax(-1, 100)(caps, nil))
+	// and ties share it
+	assert.Equal(t, []int{50, 0, 50}, lb.Softmax(0, 100)([]float64{90, 10, 90}, nil))
+
+	assert.Equal(t, []int{0, 0, 0}, lb.Softmax(1, 100)([]float64{0, 0, 0}, nil))
+}
@@ -0,0 +1,66 @@
+package lb
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+// Wraps f so that calls beyond what limiter allows fail right away with
+// [ErrExceedCap] instead of reaching f, letting the load balancer learn the
+// limit and send the call elsewhere. The limiter isn't waited on, use it
+// directly in f for a handler that blocks instead.
+func WrapWithLimiter[T any, U any](f HandlerFunc[T, U], limiter *rate.Limiter) HandlerFunc[T, U] {
+	return func(ctx context.Context, param T) (U, error) {
+		if err := ctx.Err(); err != nil {
+			var res U
+			return res, err
+		}
+		if !limiter.Allow() {
+			var res U
+			return res, ErrExceedCap
+		}
+		return f(ctx, param)
+	}
+}
+
+// Wraps f so that at most n calls run at once, further calls fail right away
+// with [ErrExceedCap] instead of reaching f.
+func WrapWithSemaphore[T any, U any](f HandlerFunc[T, U], n int) HandlerFunc[T, U] {
+	sem := make(chan struct{}, n)
+	return func(ctx context.Context, param T) (U, error) {
+		if err := ctx.Err(); err != nil {
+			var res U
+			return res, err
+		}
+		select {
+		case sem <- struct{}{}:
+		default:
+			var res U
+			return res, ErrExceedCap
+		}
+		defer func() { <-sem }()
+		return f(ctx, param)
+	}
+}
+
+// Like [WrapWithSemaphore], but each call takes as many units of sem as its
+// cost, see [WithCost], so expensive calls leave less room for others. Share
+// sem between handlers to put them behind a common bulkhead. Calls costing
+// more than sem holds never get through.
+func WrapWithWeightedSemaphore[T any, U any](f HandlerFunc[T, U], sem *semaphore.Weighted) HandlerFunc[T, U] {
+	return func(ctx context.Context, param T) (U, error) {
+		if err := ctx.Err(); err != nil {
+			var res U
+			return res, err
+		}
+		n := int64(cost(ctx))
+		if !sem.TryAcquire(n) {
+			var res U
+			return res, ErrExceedCap
+		}
+		defer sem.Release(n)
+		return f(ctx, param)
+	}
+}
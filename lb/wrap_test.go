@@ -0,0 +1,79 @@
+package lb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/podocarp/dynlb-go/lb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+)
+
+func double(ctx context.Context, param int) (int, error) {
+	return param * 2, nil
+}
+
+func TestWrapWithLimiter(t *testing.T) {
+	limiter := rate.NewLimiter(rate.Limit(1), 2)
+	f := lb.WrapWithLimiter(double, limiter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f(ctx, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// The cancelled call didn't use up a token
+	for range 2 {
+		res, err := f(context.Background(), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, res)
+	}
+	_, err = f(context.Background(), 1)
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+}
+
+func TestWrapWithSemaphore(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	f := lb.WrapWithSemaphore(func(ctx context.Context, param int) (int, error) {
+		started <- struct{}{}
+		<-gate
+		return param, nil
+	}, 1)
+
+	done := make(chan error)
+	go func() {
+		_, err := f(context.Background(), 1)
+		done <- err
+	}()
+	<-started
+
+	_, err := f(context.Background(), 2)
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+
+	close(gate)
+	assert.NoError(t, <-done)
+	go func() { <-started }()
+	res, err := f(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res)
+}
+
+func TestWrapWithWeightedSemaphore(t *testing.T) {
+	sem := semaphore.NewWeighted(3)
+	f := lb.WrapWithWeightedSemaphore(double, sem)
+
+	assert.True(t, sem.TryAcquire(2))
+	_, err := f(lb.WithCost(context.Background(), 2), 1)
+	assert.ErrorIs(t, err, lb.ErrExceedCap)
+	res, err := f(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res)
+
+	// Units are given back once the call is done
+	sem.Release(2)
+	_, err = f(lb.WithCost(context.Background(), 3), 1)
+	assert.NoError(t, err)
+	assert.True(t, sem.TryAcquire(3))
+}